@@ -0,0 +1,20 @@
+package versionstore
+
+import "context"
+
+// actorContextKey is the context key of the id of the user acting on the
+// store
+type actorContextKey struct{}
+
+// WithActor returns a context carrying the id of the user acting on the
+// store, recorded by the changes made with that context
+func WithActor(ctx context.Context, actorID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actorID)
+}
+
+// ActorFromContext returns the id of the user acting on the store, empty if
+// the context does not carry one
+func ActorFromContext(ctx context.Context) string {
+	actorID, _ := ctx.Value(actorContextKey{}).(string)
+	return actorID
+}
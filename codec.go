@@ -0,0 +1,121 @@
+package versionstore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/versionstore/diff"
+)
+
+// DEFAULT_KEYFRAME_INTERVAL is the number of versions between two full
+// content snapshots when a content codec is used without an interval
+const DEFAULT_KEYFRAME_INTERVAL = 10
+
+// ContentCodec encodes the content of a version as a delta against the
+// content of its parent, so that only the changes are stored. Every
+// KeyframeInterval versions the full content is stored instead, which
+// bounds the number of deltas applied to read a version.
+type ContentCodec interface {
+	// Name identifies the codec in the rows it encoded. It must not change
+	// once versions are stored.
+	Name() string
+
+	// Encode returns the delta turning base into content
+	Encode(base string, content string) (string, error)
+
+	// Decode applies a delta returned by Encode to base
+	Decode(base string, delta string) (string, error)
+}
+
+// NewLineDeltaCodec returns a codec storing the lines changed since the
+// parent version, suited to text documents edited a few lines at a time
+func NewLineDeltaCodec() ContentCodec {
+	return lineDeltaCodec{}
+}
+
+// lineDeltaCodec encodes a delta as one instruction per line: "=n" copies
+// the next n lines of the base, "-n" skips them and "+text" inserts a line
+type lineDeltaCodec struct{}
+
+var _ ContentCodec = lineDeltaCodec{}
+
+func (lineDeltaCodec) Name() string {
+	return "line_delta"
+}
+
+func (lineDeltaCodec) Encode(base string, content string) (string, error) {
+	instructions := []string{}
+
+	var op diff.Op
+	count := 0
+	flush := func() {
+		switch {
+		case count == 0:
+		case op == diff.OP_EQUAL:
+			instructions = append(instructions, "="+strconv.Itoa(count))
+		case op == diff.OP_DELETE:
+			instructions = append(instructions, "-"+strconv.Itoa(count))
+		}
+		count = 0
+	}
+
+	for _, edit := range diff.Lines(base, content) {
+		if edit.Op != op {
+			flush()
+			op = edit.Op
+		}
+
+		if edit.Op == diff.OP_INSERT {
+			instructions = append(instructions, "+"+edit.Text)
+			continue
+		}
+
+		count++
+	}
+	flush()
+
+	return strings.Join(instructions, "\n"), nil
+}
+
+func (lineDeltaCodec) Decode(base string, delta string) (string, error) {
+	baseLines := []string{}
+	if base != "" {
+		baseLines = strings.Split(base, "\n")
+	}
+
+	instructions := []string{}
+	if delta != "" {
+		instructions = strings.Split(delta, "\n")
+	}
+
+	lines := []string{}
+	position := 0
+	for _, instruction := range instructions {
+		if instruction == "" {
+			return "", errors.New("version store: invalid line delta")
+		}
+
+		if instruction[0] == '+' {
+			lines = append(lines, instruction[1:])
+			continue
+		}
+
+		count, err := strconv.Atoi(instruction[1:])
+		if err != nil || count < 0 || position+count > len(baseLines) {
+			return "", errors.New("version store: invalid line delta")
+		}
+
+		switch instruction[0] {
+		case '=':
+			lines = append(lines, baseLines[position:position+count]...)
+		case '-':
+		default:
+			return "", errors.New("version store: invalid line delta")
+		}
+
+		position += count
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
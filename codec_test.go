@@ -0,0 +1,47 @@
+package versionstore
+
+import "testing"
+
+func TestLineDeltaCodecRoundTrip(t *testing.T) {
+	codec := NewLineDeltaCodec()
+
+	cases := []struct {
+		base    string
+		content string
+	}{
+		{"", ""},
+		{"", "first"},
+		{"first", ""},
+		{"a\nb\nc", "a\nb\nc"},
+		{"a\nb\nc", "start\na\nb\nc\nend"},
+		{"a\nb\nc", "a\nc"},
+		{"a\nb\nc\n", "a\nB\nc\n"},
+		{"a\n\nb", "\n\na\n"},
+	}
+
+	for _, c := range cases {
+		delta, err := codec.Encode(c.base, c.content)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		content, err := codec.Decode(c.base, delta)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if content != c.content {
+			t.Fatalf("Decoded content MUST be %q, found %q", c.content, content)
+		}
+	}
+}
+
+func TestLineDeltaCodecInvalidDelta(t *testing.T) {
+	codec := NewLineDeltaCodec()
+
+	for _, delta := range []string{"=5", "x1", "=a", "-1\n\n=1"} {
+		if _, err := codec.Decode("a\nb", delta); err == nil {
+			t.Fatalf("Decoding %q MUST fail", delta)
+		}
+	}
+}
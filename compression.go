@@ -0,0 +1,121 @@
+package versionstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses the content of versions before it is stored. Each
+// row records the name of the compressor that wrote it, so rows written
+// with and without compression can be read side by side. Algorithms other
+// than gzip and zstd can be plugged in by implementing this interface.
+type Compressor interface {
+	// Name identifies the compressor in the rows it compressed. It must not
+	// change once versions are stored.
+	Name() string
+
+	// Compress returns the compressed data
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress returns the data passed to Compress
+	Decompress(data []byte) ([]byte, error)
+}
+
+// NewGzipCompressor returns a compressor using gzip at the given level, one
+// of the compress/gzip levels
+func NewGzipCompressor(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+// gzipCompressor compresses with compress/gzip
+type gzipCompressor struct {
+	level int
+}
+
+var _ Compressor = gzipCompressor{}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writer, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// NewZstdCompressor returns a compressor using zstd at the given level, from
+// 1 (fastest) to 22 (best compression) as for the zstd command line. The
+// encoder and decoder are created on first use and shared by every call.
+func NewZstdCompressor(level int) Compressor {
+	return &zstdCompressor{level: zstd.EncoderLevelFromZstd(level)}
+}
+
+// zstdCompressor compresses with github.com/klauspost/compress/zstd. Its
+// EncodeAll and DecodeAll calls are safe for concurrent use.
+type zstdCompressor struct {
+	level zstd.EncoderLevel
+
+	encoderOnce sync.Once
+	encoder     *zstd.Encoder
+	encoderErr  error
+
+	decoderOnce sync.Once
+	decoder     *zstd.Decoder
+	decoderErr  error
+}
+
+var _ Compressor = (*zstdCompressor)(nil)
+
+func (*zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (c *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	c.encoderOnce.Do(func() {
+		c.encoder, c.encoderErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(c.level))
+	})
+	if c.encoderErr != nil {
+		return nil, c.encoderErr
+	}
+
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	c.decoderOnce.Do(func() {
+		c.decoder, c.decoderErr = zstd.NewReader(nil)
+	})
+	if c.decoderErr != nil {
+		return nil, c.decoderErr
+	}
+
+	return c.decoder.DecodeAll(data, nil)
+}
@@ -2,13 +2,31 @@ package versionstore
 
 // Column names for the version table
 const (
-	COLUMN_CONTENT         = "content"
-	COLUMN_CREATED_AT      = "created_at"
-	COLUMN_ENTITY_ID       = "entity_id"
-	COLUMN_ENTITY_TYPE     = "entity_type"
-	COLUMN_ID              = "id"
-	COLUMN_SOFT_DELETED_AT = "soft_deleted_at"
+	COLUMN_AUTHOR_ID           = "author_id"
+	COLUMN_BRANCH              = "branch"
+	COLUMN_CHANGESET_ID        = "changeset_id"
+	COLUMN_CONTENT             = "content"
+	COLUMN_CONTENT_CODEC       = "content_codec"
+	COLUMN_CONTENT_COMPRESSION = "content_compression"
+	COLUMN_CONTENT_HASH        = "content_hash"
+	COLUMN_CONTENT_KEY_ID      = "content_key_id"
+	COLUMN_CREATED_AT          = "created_at"
+	COLUMN_DELTA_BASE_ID       = "delta_base_id"
+	COLUMN_DELTA_DEPTH         = "delta_depth"
+	COLUMN_ENTITY_ID           = "entity_id"
+	COLUMN_ENTITY_TYPE         = "entity_type"
+	COLUMN_ID                  = "id"
+	COLUMN_MERGE_PARENT_ID     = "merge_parent_id"
+	COLUMN_MESSAGE             = "message"
+	COLUMN_METADATA            = "metadata"
+	COLUMN_PARENT_ID           = "parent_id"
+	COLUMN_RESTORED_FROM       = "restored_from"
+	COLUMN_SOFT_DELETED_AT     = "soft_deleted_at"
+	COLUMN_VERSION_NUMBER      = "version_number"
 )
 
 // MAX_DATETIME is a far-future datetime used as the default soft-delete sentinel.
 const MAX_DATETIME = "9999-12-31 23:59:59"
+
+// DEFAULT_BRANCH is the branch of versions created without a branch name.
+const DEFAULT_BRANCH = "main"
@@ -0,0 +1,306 @@
+// Package diff compares two contents and describes the changes between them
+// as unified line hunks, word level edits or, for JSON, an RFC 6902 JSON Patch.
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Format defines the kind of diff produced
+type Format string
+
+const (
+	// FORMAT_UNIFIED compares the contents line by line, grouping the
+	// changes into hunks as in a unified diff
+	FORMAT_UNIFIED Format = "unified"
+	// FORMAT_WORDS compares the contents word by word
+	FORMAT_WORDS Format = "words"
+	// FORMAT_JSON_PATCH compares JSON contents and produces an RFC 6902
+	// JSON Patch turning the first into the second
+	FORMAT_JSON_PATCH Format = "json_patch"
+)
+
+// Op defines what happened to a piece of content
+type Op string
+
+const (
+	OP_EQUAL  Op = "equal"
+	OP_INSERT Op = "insert"
+	OP_DELETE Op = "delete"
+)
+
+// DEFAULT_CONTEXT is the number of unchanged lines shown around each change
+// of a unified diff
+const DEFAULT_CONTEXT = 3
+
+// Result is the difference between two contents. Only the field matching
+// the format is set.
+type Result struct {
+	Format Format
+
+	// Hunks holds the changed regions of a unified diff
+	Hunks []Hunk
+
+	// Edits holds the whole content of a word diff, split into runs of
+	// equal, inserted and deleted text
+	Edits []Edit
+
+	// Patch holds the operations of a JSON Patch
+	Patch []Operation
+}
+
+// Equal returns true if the contents compared are the same
+func (r *Result) Equal() bool {
+	for _, edit := range r.Edits {
+		if edit.Op != OP_EQUAL {
+			return false
+		}
+	}
+	return len(r.Hunks) == 0 && len(r.Patch) == 0
+}
+
+// String renders the result as text: a unified diff, a word diff marking
+// deletions as [-text-] and insertions as {+text+}, or the JSON Patch
+// document
+func (r *Result) String() string {
+	switch r.Format {
+	case FORMAT_UNIFIED:
+		return FormatUnified(r.Hunks)
+	case FORMAT_WORDS:
+		return FormatWords(r.Edits)
+	case FORMAT_JSON_PATCH:
+		patch := r.Patch
+		if patch == nil {
+			patch = []Operation{}
+		}
+		encoded, err := json.Marshal(patch)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	default:
+		return ""
+	}
+}
+
+// Diff compares the contents using the given format
+func Diff(from string, to string, format Format) (*Result, error) {
+	result := &Result{Format: format}
+
+	switch format {
+	case FORMAT_UNIFIED:
+		result.Hunks = Unified(from, to, DEFAULT_CONTEXT)
+	case FORMAT_WORDS:
+		result.Edits = Words(from, to)
+	case FORMAT_JSON_PATCH:
+		patch, err := JSONPatch(from, to)
+		if err != nil {
+			return nil, err
+		}
+		result.Patch = patch
+	default:
+		return nil, errors.New("diff: unknown format: " + string(format))
+	}
+
+	return result, nil
+}
+
+// Edit is a run of content that is equal in both contents, or was inserted
+// or deleted
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// tokenEdit is the fate of a single token of the compared sequences
+type tokenEdit struct {
+	op    Op
+	token string
+}
+
+// compareTokens returns the shortest edit script turning a into b, using
+// the linear space variant of the Myers O(ND) algorithm: the sequences are
+// split where the forward and backward searches meet, and each half is
+// compared in turn, so memory stays O(n+m) however different they are
+func compareTokens(a []string, b []string) []tokenEdit {
+	edits := make([]tokenEdit, 0, len(a)+len(b))
+
+	// sequences without a token in common are replaced whole, without
+	// searching
+	tokens := map[string]bool{}
+	for _, token := range a {
+		tokens[token] = true
+	}
+
+	shared := false
+	for _, token := range b {
+		if tokens[token] {
+			shared = true
+			break
+		}
+	}
+
+	if !shared {
+		for _, token := range a {
+			edits = append(edits, tokenEdit{op: OP_DELETE, token: token})
+		}
+		for _, token := range b {
+			edits = append(edits, tokenEdit{op: OP_INSERT, token: token})
+		}
+		return edits
+	}
+
+	return compareRange(a, b, edits)
+}
+
+// compareRange appends to edits the shortest edit script turning a into b
+func compareRange(a []string, b []string, edits []tokenEdit) []tokenEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for _, token := range a[:prefix] {
+		edits = append(edits, tokenEdit{op: OP_EQUAL, token: token})
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y, found := 0, 0, false
+	if len(a) > 0 && len(b) > 0 {
+		x, y, found = bisectTokens(a, b)
+	}
+
+	if found {
+		edits = compareRange(a[:x], b[:y], edits)
+		edits = compareRange(a[x:], b[y:], edits)
+	} else {
+		for _, token := range a {
+			edits = append(edits, tokenEdit{op: OP_DELETE, token: token})
+		}
+		for _, token := range b {
+			edits = append(edits, tokenEdit{op: OP_INSERT, token: token})
+		}
+	}
+
+	for _, token := range common {
+		edits = append(edits, tokenEdit{op: OP_EQUAL, token: token})
+	}
+
+	return edits
+}
+
+// bisectTokens finds the middle of the shortest edit script turning a into
+// b, by searching forward from the start and backward from the end until
+// the paths overlap. It returns false when the sequences have nothing in
+// common, or when the split would not make them shorter.
+func bisectTokens(a []string, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+
+	// one spare slot each side of the diagonals -maxD..maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+
+	// the paths can only overlap on the forward search when the difference
+	// of the lengths is odd, on the backward search when it is even
+	front := delta%2 != 0
+
+	// diagonals running off the edit graph are no longer searched
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + forwardStart; k <= d-forwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			forward[offset+k] = x
+
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case front:
+				reverse := offset + delta - k
+				if reverse >= 0 && reverse < len(backward) && backward[reverse] != -1 && x >= n-backward[reverse] {
+					return bisectSplit(n, m, x, y)
+				}
+			}
+		}
+
+		for k := -d + backwardStart; k <= d-backwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+
+			backward[offset+k] = x
+
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !front:
+				reverse := offset + delta - k
+				if reverse >= 0 && reverse < len(forward) && forward[reverse] != -1 && forward[reverse] >= n-x {
+					return bisectSplit(n, m, forward[reverse], forward[reverse]-(reverse-offset))
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// bisectSplit returns the split point unless it leaves one half as long as
+// the whole, which would not make progress
+func bisectSplit(n int, m int, x int, y int) (int, int, bool) {
+	if (x == 0 && y == 0) || (x == n && y == m) {
+		return 0, 0, false
+	}
+	return x, y, true
+}
+
+// splitLines splits content into lines, an empty content having no lines
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(content, "\n")
+}
@@ -0,0 +1,178 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj"
+	to := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk"
+
+	hunks := Unified(from, to, 1)
+
+	if len(hunks) != 2 {
+		t.Fatal("Unified MUST return 2 hunks. Found:", len(hunks))
+	}
+
+	expected := "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -10 +10,2 @@\n j\n+k\n"
+	if FormatUnified(hunks) != expected {
+		t.Fatal("Unified diff MUST be", expected, "Found:", FormatUnified(hunks))
+	}
+
+	line := hunks[0].Lines[2]
+	if line.Op != OP_INSERT || line.Text != "B" || line.FromLine != 0 || line.ToLine != 2 {
+		t.Fatal("Inserted line MUST be numbered in the second content. Found:", line)
+	}
+}
+
+func TestUnified_MergesCloseChanges(t *testing.T) {
+	hunks := Unified("a\nb\nc\nd", "A\nb\nc\nD", 1)
+
+	if len(hunks) != 1 {
+		t.Fatal("Changes with overlapping context MUST share a hunk. Found:", len(hunks))
+	}
+
+	if hunks[0].FromLine != 1 || hunks[0].FromCount != 4 || hunks[0].ToCount != 4 {
+		t.Fatal("Hunk MUST cover the 4 lines. Found:", hunks[0])
+	}
+}
+
+func TestUnified_EmptyFrom(t *testing.T) {
+	hunks := Unified("", "a\nb", DEFAULT_CONTEXT)
+
+	if FormatUnified(hunks) != "@@ -0,0 +1,2 @@\n+a\n+b\n" {
+		t.Fatal("Unified diff of an empty content MUST insert every line. Found:", FormatUnified(hunks))
+	}
+}
+
+func TestUnified_Equal(t *testing.T) {
+	if len(Unified("a\nb", "a\nb", DEFAULT_CONTEXT)) != 0 {
+		t.Fatal("Equal contents MUST NOT have hunks")
+	}
+}
+
+func TestWords(t *testing.T) {
+	from := "The quick brown fox."
+	to := "The slow brown fox!"
+
+	edits := Words(from, to)
+
+	if FormatWords(edits) != "The [-quick-]{+slow+} brown fox[-.-]{+!+}" {
+		t.Fatal("Word diff MUST mark the changed words. Found:", FormatWords(edits))
+	}
+
+	var fromText, toText strings.Builder
+	for _, edit := range edits {
+		if edit.Op != OP_INSERT {
+			fromText.WriteString(edit.Text)
+		}
+		if edit.Op != OP_DELETE {
+			toText.WriteString(edit.Text)
+		}
+	}
+
+	if fromText.String() != from || toText.String() != to {
+		t.Fatal("Word edits MUST cover both contents entirely")
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	from := `{"title":"Home","tags":["a","b","c"],"meta":{"draft":true},"a/b":1}`
+	to := `{"title":"Home page","tags":["a","x"],"meta":{},"price":10.50,"a/b":1}`
+
+	patch, err := JSONPatch(from, to)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	result := &Result{Format: FORMAT_JSON_PATCH, Patch: patch}
+
+	expected := `[{"op":"remove","path":"/meta/draft"},` +
+		`{"op":"add","path":"/price","value":10.50},` +
+		`{"op":"replace","path":"/tags/1","value":"x"},` +
+		`{"op":"remove","path":"/tags/2"},` +
+		`{"op":"replace","path":"/title","value":"Home page"}]`
+
+	if result.String() != expected {
+		t.Fatal("JSON Patch MUST be", expected, "Found:", result.String())
+	}
+}
+
+func TestJSONPatch_EscapesPath(t *testing.T) {
+	patch, err := JSONPatch(`{"a/b":1,"c~d":1}`, `{"a/b":2,"c~d":2}`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(patch) != 2 || patch[0].Path != "/a~1b" || patch[1].Path != "/c~0d" {
+		t.Fatal("JSON Patch paths MUST be escaped. Found:", patch)
+	}
+}
+
+func TestJSONPatch_InvalidJSON(t *testing.T) {
+	if _, err := JSONPatch(`{}`, `not json`); err == nil {
+		t.Fatal("JSON Patch of invalid JSON MUST fail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	result, err := Diff("a", "b", FORMAT_UNIFIED)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if result.Equal() {
+		t.Fatal("Different contents MUST NOT be equal")
+	}
+
+	result, err = Diff("a b", "a b", FORMAT_WORDS)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !result.Equal() {
+		t.Fatal("Same contents MUST be equal")
+	}
+
+	if _, err := Diff("a", "b", Format("unknown")); err == nil {
+		t.Fatal("Unknown format MUST fail")
+	}
+}
+
+func TestLines(t *testing.T) {
+	edits := Lines("a\nb\nc", "a\nc\nd")
+
+	ops := []string{}
+	for _, edit := range edits {
+		ops = append(ops, string(edit.Op)+":"+edit.Text)
+	}
+
+	if strings.Join(ops, ",") != "equal:a,delete:b,equal:c,insert:d" {
+		t.Fatal("Lines MUST return one edit per line. Found:", strings.Join(ops, ","))
+	}
+}
+
+func TestCompareTokens_LargeContents(t *testing.T) {
+	from := []string{}
+	to := []string{}
+	for i := range 5000 {
+		from = append(from, "from "+strconv.Itoa(i))
+		to = append(to, "to "+strconv.Itoa(i))
+		if i%100 == 0 {
+			to[i] = from[i]
+		}
+	}
+
+	equal := 0
+	for _, edit := range compareTokens(from, to) {
+		if edit.op == OP_EQUAL {
+			equal++
+		}
+	}
+
+	if equal != 50 {
+		t.Fatal("Large contents MUST keep every common line. Found:", equal)
+	}
+}
@@ -0,0 +1,162 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operation is an operation of an RFC 6902 JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch compares two JSON documents and returns the RFC 6902 JSON Patch
+// turning the first into the second. Objects are compared key by key and
+// arrays index by index; any other change replaces the value.
+func JSONPatch(from string, to string) ([]Operation, error) {
+	fromValue, err := decodeJSON(from)
+	if err != nil {
+		return nil, errors.New("diff: from content is not valid JSON")
+	}
+
+	toValue, err := decodeJSON(to)
+	if err != nil {
+		return nil, errors.New("diff: to content is not valid JSON")
+	}
+
+	patch := []Operation{}
+	if err := comparePatchValues("", fromValue, toValue, &patch); err != nil {
+		return nil, err
+	}
+
+	return patch, nil
+}
+
+// comparePatchValues appends to patch the operations turning from into to
+func comparePatchValues(path string, from any, to any, patch *[]Operation) error {
+	if reflect.DeepEqual(from, to) {
+		return nil
+	}
+
+	fromObject, fromIsObject := from.(map[string]any)
+	toObject, toIsObject := to.(map[string]any)
+	if fromIsObject && toIsObject {
+		return comparePatchObjects(path, fromObject, toObject, patch)
+	}
+
+	fromArray, fromIsArray := from.([]any)
+	toArray, toIsArray := to.([]any)
+	if fromIsArray && toIsArray {
+		return comparePatchArrays(path, fromArray, toArray, patch)
+	}
+
+	return appendOperation(patch, "replace", path, to)
+}
+
+// comparePatchObjects compares two objects key by key, in key order
+func comparePatchObjects(path string, from map[string]any, to map[string]any, patch *[]Operation) error {
+	keys := []string{}
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+
+		var err error
+		switch {
+		case !inTo:
+			err = appendOperation(patch, "remove", keyPath, nil)
+		case !inFrom:
+			err = appendOperation(patch, "add", keyPath, toValue)
+		default:
+			err = comparePatchValues(keyPath, fromValue, toValue, patch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// comparePatchArrays compares two arrays index by index, then appends the
+// extra elements or removes the missing ones from the end
+func comparePatchArrays(path string, from []any, to []any, patch *[]Operation) error {
+	common := min(len(from), len(to))
+
+	for i := 0; i < common; i++ {
+		if err := comparePatchValues(path+"/"+strconv.Itoa(i), from[i], to[i], patch); err != nil {
+			return err
+		}
+	}
+
+	for i := common; i < len(to); i++ {
+		if err := appendOperation(patch, "add", path+"/"+strconv.Itoa(i), to[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := len(from) - 1; i >= common; i-- {
+		if err := appendOperation(patch, "remove", path+"/"+strconv.Itoa(i), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendOperation appends an operation, encoding its value unless it is a
+// remove
+func appendOperation(patch *[]Operation, op string, path string, value any) error {
+	operation := Operation{Op: op, Path: path}
+
+	if op != "remove" {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		operation.Value = encoded
+	}
+
+	*patch = append(*patch, operation)
+	return nil
+}
+
+// decodeJSON decodes a JSON document, keeping numbers as json.Number so that
+// their precision is preserved
+func decodeJSON(content string) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, errors.New("unexpected content after the JSON document")
+	}
+
+	return value, nil
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
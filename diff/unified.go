@@ -0,0 +1,176 @@
+package diff
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Hunk is a changed region of a unified diff, with the unchanged lines
+// around it
+type Hunk struct {
+	// FromLine and FromCount locate the region in the first content.
+	// FromLine is 1-based; when FromCount is 0 it is the line after which
+	// the lines were inserted.
+	FromLine  int `json:"from_line"`
+	FromCount int `json:"from_count"`
+
+	// ToLine and ToCount locate the region in the second content
+	ToLine  int `json:"to_line"`
+	ToCount int `json:"to_count"`
+
+	Lines []Line `json:"lines"`
+}
+
+// Line is a line of a hunk
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+
+	// FromLine is the 1-based line number in the first content, 0 for an
+	// inserted line
+	FromLine int `json:"from_line"`
+
+	// ToLine is the 1-based line number in the second content, 0 for a
+	// deleted line
+	ToLine int `json:"to_line"`
+}
+
+// Unified compares the contents line by line and groups the changes into
+// hunks, each with up to context unchanged lines before and after it
+func Unified(from string, to string, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+
+	lines := []Line{}
+	fromLine, toLine := 0, 0
+	for _, edit := range compareTokens(splitLines(from), splitLines(to)) {
+		line := Line{Op: edit.op, Text: edit.token}
+
+		switch edit.op {
+		case OP_EQUAL:
+			fromLine++
+			toLine++
+			line.FromLine, line.ToLine = fromLine, toLine
+		case OP_DELETE:
+			fromLine++
+			line.FromLine = fromLine
+		case OP_INSERT:
+			toLine++
+			line.ToLine = toLine
+		}
+
+		lines = append(lines, line)
+	}
+
+	hunks := []Hunk{}
+	for start := 0; start < len(lines); {
+		if lines[start].Op == OP_EQUAL {
+			start++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough for the
+		// context of both to overlap
+		end := start
+		for next := start + 1; next < len(lines); next++ {
+			if lines[next].Op == OP_EQUAL {
+				continue
+			}
+			if next-end-1 > 2*context {
+				break
+			}
+			end = next
+		}
+
+		first := max(start-context, 0)
+		last := min(end+context, len(lines)-1)
+
+		hunks = append(hunks, newHunk(lines[first:last+1], lines[:first]))
+
+		start = last + 1
+	}
+
+	return hunks
+}
+
+// newHunk builds a hunk from its lines, counting the lines before it to
+// locate it
+func newHunk(lines []Line, before []Line) Hunk {
+	hunk := Hunk{Lines: append([]Line(nil), lines...)}
+
+	fromBefore, toBefore := 0, 0
+	for _, line := range before {
+		if line.Op != OP_INSERT {
+			fromBefore++
+		}
+		if line.Op != OP_DELETE {
+			toBefore++
+		}
+	}
+
+	for _, line := range lines {
+		if line.Op != OP_INSERT {
+			hunk.FromCount++
+		}
+		if line.Op != OP_DELETE {
+			hunk.ToCount++
+		}
+	}
+
+	hunk.FromLine = fromBefore + 1
+	if hunk.FromCount == 0 {
+		hunk.FromLine = fromBefore
+	}
+
+	hunk.ToLine = toBefore + 1
+	if hunk.ToCount == 0 {
+		hunk.ToLine = toBefore
+	}
+
+	return hunk
+}
+
+// FormatUnified renders hunks as the body of a unified diff
+func FormatUnified(hunks []Hunk) string {
+	var sb strings.Builder
+
+	for _, hunk := range hunks {
+		sb.WriteString("@@ -" + formatRange(hunk.FromLine, hunk.FromCount) +
+			" +" + formatRange(hunk.ToLine, hunk.ToCount) + " @@\n")
+
+		for _, line := range hunk.Lines {
+			switch line.Op {
+			case OP_INSERT:
+				sb.WriteString("+")
+			case OP_DELETE:
+				sb.WriteString("-")
+			default:
+				sb.WriteString(" ")
+			}
+			sb.WriteString(line.Text + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// formatRange formats the start and count of a hunk range, leaving out a
+// count of 1 as unified diffs do
+func formatRange(start int, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(count)
+}
+
+// Lines compares the contents line by line and returns one edit per line.
+// Joining the equal and deleted lines with "\n" gives the first content,
+// joining the equal and inserted lines gives the second.
+func Lines(from string, to string) []Edit {
+	edits := []Edit{}
+	for _, edit := range compareTokens(splitLines(from), splitLines(to)) {
+		edits = append(edits, Edit{Op: edit.op, Text: edit.token})
+	}
+	return edits
+}
@@ -0,0 +1,75 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words compares the contents word by word. The edits cover both contents
+// entirely: joining the equal and deleted runs gives the first content,
+// joining the equal and inserted runs gives the second.
+func Words(from string, to string) []Edit {
+	edits := []Edit{}
+
+	for _, edit := range compareTokens(splitWords(from), splitWords(to)) {
+		last := len(edits) - 1
+		if last >= 0 && edits[last].Op == edit.op {
+			edits[last].Text += edit.token
+			continue
+		}
+		edits = append(edits, Edit{Op: edit.op, Text: edit.token})
+	}
+
+	return edits
+}
+
+// FormatWords renders word edits as text, marking deletions as [-text-] and
+// insertions as {+text+}
+func FormatWords(edits []Edit) string {
+	var sb strings.Builder
+
+	for _, edit := range edits {
+		switch edit.Op {
+		case OP_DELETE:
+			sb.WriteString("[-" + edit.Text + "-]")
+		case OP_INSERT:
+			sb.WriteString("{+" + edit.Text + "+}")
+		default:
+			sb.WriteString(edit.Text)
+		}
+	}
+
+	return sb.String()
+}
+
+// splitWords splits content into words, runs of whitespace and single
+// punctuation characters, so that joining the tokens gives back the content
+func splitWords(content string) []string {
+	tokens := []string{}
+
+	runes := []rune(content)
+	for start := 0; start < len(runes); {
+		end := start + 1
+
+		switch {
+		case unicode.IsSpace(runes[start]):
+			for end < len(runes) && unicode.IsSpace(runes[end]) {
+				end++
+			}
+		case isWordRune(runes[start]):
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+		}
+
+		tokens = append(tokens, string(runes[start:end]))
+		start = end
+	}
+
+	return tokens
+}
+
+// isWordRune returns true for the characters words are made of
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
@@ -0,0 +1,99 @@
+package versionstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// Encryptor encrypts the content of versions at rest. Each row records the
+// id of the key its content was encrypted with, so that keys can be rotated
+// while rows encrypted with older keys stay readable. The content is
+// encrypted together with the additional data identifying its row, which
+// must be authenticated but not encrypted, so that content copied to
+// another row cannot be decrypted. The content hash of a version is not
+// encrypted, but keyed with the store's content hash key.
+type Encryptor interface {
+	// KeyID returns the id of the key new content is encrypted with
+	KeyID() string
+
+	// Encrypt encrypts the data with the key with the given id,
+	// authenticating the additional data along with it
+	Encrypt(keyID string, data []byte, additionalData []byte) ([]byte, error)
+
+	// Decrypt decrypts data encrypted with the key with the given id and
+	// the same additional data
+	Decrypt(keyID string, data []byte, additionalData []byte) ([]byte, error)
+}
+
+// NewAESGCMEncryptor returns an encryptor using AES-GCM with the given keys
+// of 16, 24 or 32 bytes, indexed by key id. New content is encrypted with
+// the key with id currentKeyID.
+func NewAESGCMEncryptor(keys map[string][]byte, currentKeyID string) (Encryptor, error) {
+	ciphers := map[string]cipher.AEAD{}
+
+	for keyID, key := range keys {
+		if keyID == "" {
+			return nil, errors.New("version store: encryption key id is empty")
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		ciphers[keyID] = aead
+	}
+
+	if _, ok := ciphers[currentKeyID]; !ok {
+		return nil, errors.New("version store: current encryption key not found: " + currentKeyID)
+	}
+
+	return aesGCMEncryptor{ciphers: ciphers, keyID: currentKeyID}, nil
+}
+
+// aesGCMEncryptor encrypts with AES-GCM, prefixing the ciphertext with its
+// random nonce
+type aesGCMEncryptor struct {
+	ciphers map[string]cipher.AEAD
+	keyID   string
+}
+
+var _ Encryptor = aesGCMEncryptor{}
+
+func (e aesGCMEncryptor) KeyID() string {
+	return e.keyID
+}
+
+func (e aesGCMEncryptor) Encrypt(keyID string, data []byte, additionalData []byte) ([]byte, error) {
+	aead, ok := e.ciphers[keyID]
+	if !ok {
+		return nil, errors.New("version store: encryption key not found: " + keyID)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, data, additionalData), nil
+}
+
+func (e aesGCMEncryptor) Decrypt(keyID string, data []byte, additionalData []byte) ([]byte, error) {
+	aead, ok := e.ciphers[keyID]
+	if !ok {
+		return nil, errors.New("version store: encryption key not found: " + keyID)
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("version store: encrypted content is too short")
+	}
+
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+}
@@ -0,0 +1,68 @@
+package versionstore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAESGCMEncryptor(t *testing.T) {
+	encryptor, err := NewAESGCMEncryptor(map[string][]byte{
+		"2024": bytes.Repeat([]byte("a"), 32),
+		"2025": bytes.Repeat([]byte("b"), 16),
+	}, "2025")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if encryptor.KeyID() != "2025" {
+		t.Fatal("Current key id MUST be 2025. Found:", encryptor.KeyID())
+	}
+
+	encrypted, err := encryptor.Encrypt("2024", []byte("secret"), []byte("row"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if bytes.Contains(encrypted, []byte("secret")) {
+		t.Fatal("Encrypted data MUST NOT contain the plaintext")
+	}
+
+	again, err := encryptor.Encrypt("2024", []byte("secret"), []byte("row"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if bytes.Equal(encrypted, again) {
+		t.Fatal("Encrypting twice MUST use a different nonce")
+	}
+
+	decrypted, err := encryptor.Decrypt("2024", encrypted, []byte("row"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if string(decrypted) != "secret" {
+		t.Fatal("Decrypted data MUST be secret. Found:", string(decrypted))
+	}
+
+	if _, err := encryptor.Decrypt("2025", encrypted, []byte("row")); err == nil {
+		t.Fatal("Decrypting with another key MUST fail")
+	}
+
+	if _, err := encryptor.Decrypt("2024", encrypted, []byte("other row")); err == nil {
+		t.Fatal("Decrypting with other additional data MUST fail")
+	}
+
+	if _, err := encryptor.Decrypt("unknown", encrypted, []byte("row")); err == nil {
+		t.Fatal("Decrypting with an unknown key MUST fail")
+	}
+}
+
+func TestAESGCMEncryptorInvalidKeys(t *testing.T) {
+	if _, err := NewAESGCMEncryptor(map[string][]byte{"short": []byte("short")}, "short"); err == nil {
+		t.Fatal("Key of invalid length MUST be rejected")
+	}
+
+	if _, err := NewAESGCMEncryptor(map[string][]byte{"2025": bytes.Repeat([]byte("a"), 32)}, "2026"); err == nil {
+		t.Fatal("Missing current key MUST be rejected")
+	}
+}
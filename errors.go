@@ -0,0 +1,19 @@
+package versionstore
+
+import "errors"
+
+// ErrVersionConflict is returned by VersionCreate when the expected parent
+// given in VersionCreateOptions is no longer the entity's latest version or
+// a concurrent writer took the version number, by VersionCreateMany when
+// versions of its entities are created
+// concurrently, and by ChangesetRevert when an entity changed since
+var ErrVersionConflict = errors.New("version store: version conflict, the latest version has changed")
+
+// ErrUnfilteredQuery is returned when deleting by a query filtering by none
+// of the id, entity, content hash, author, branch or metadata, which could
+// match every version, unless the delete is forced
+var ErrUnfilteredQuery = errors.New("version store: query has no filter")
+
+// ErrUnderLegalHold is matched by the *LegalHoldError returned when
+// deleting, or otherwise altering the history of, an entity under legal hold
+var ErrUnderLegalHold = errors.New("version store: entity under legal hold")
@@ -5,6 +5,7 @@ go 1.26.3
 require (
 	github.com/dracory/neat v0.27.0
 	github.com/dromara/carbon/v2 v2.6.16
+	github.com/klauspost/compress v1.18.0
 	modernc.org/sqlite v1.53.0
 )
 
@@ -3,7 +3,9 @@ package versionstore
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/dracory/versionstore/diff"
 	"github.com/dromara/carbon/v2"
 )
 
@@ -17,16 +19,67 @@ type StoreInterface interface {
 	MigrateDown(ctx context.Context, tx ...*sql.Tx) error
 	// MigrateUp creates the table
 	MigrateUp(ctx context.Context, tx ...*sql.Tx) error
-
+	// MigrateContentCodec rewrites the stored versions with the store's content codec
+	MigrateContentCodec(ctx context.Context) (int64, error)
+	// Recompress rewrites the stored versions with the given compressor
+	Recompress(ctx context.Context, compressor Compressor) (int64, error)
+	// RotateKeys re-encrypts the versions encrypted with a key with another key,
+	// or encrypts the plaintext versions of the encrypted entity types
+	RotateKeys(ctx context.Context, oldKeyID string, newKeyID string) (int64, error)
+
+	// WithTx returns a store running every query on the given transaction
+	WithTx(tx *sql.Tx) StoreInterface
+
+	ChangesetFind(ctx context.Context, changesetID string) (*Changeset, error)
+	ChangesetList(ctx context.Context, entityType string, entityID string) ([]Changeset, error)
+	ChangesetRevert(ctx context.Context, changesetID string) (*Changeset, error)
+	CommitChangeset(ctx context.Context, versions []VersionInterface, message string) (*Changeset, error)
 	EnableDebug(debug bool)
-	VersionCreate(ctx context.Context, version VersionInterface) error
+	EraseEntity(ctx context.Context, entityType string, entityID string) (*Tombstone, error)
+	HoldList(ctx context.Context, entityType string, entityID string) ([]Hold, error)
+	LabelVersion(ctx context.Context, versionID string, label string) error
+	Merge(ctx context.Context, base VersionInterface, ours VersionInterface, theirs VersionInterface, strategy MergeStrategy) (VersionInterface, error)
+	PlaceHold(ctx context.Context, entityType string, entityID string, reason string) (*Hold, error)
+	Prune(ctx context.Context, policy RetentionPolicy, dryRun bool) (*PruneReport, error)
+	PurgeSoftDeleted(ctx context.Context, olderThan time.Duration, batchSize int) (map[string]int64, error)
+	RedactVersions(ctx context.Context, query VersionQueryInterface, redact RedactFunc) (int64, error)
+	ReleaseHold(ctx context.Context, holdID string) error
+	TagHistory(ctx context.Context, entityType string, entityID string, tag string) ([]Tag, error)
+	TagVersion(ctx context.Context, versionID string, tag string) error
+	TombstoneList(ctx context.Context, entityType string, entityID string) ([]Tombstone, error)
+	UntagVersion(ctx context.Context, versionID string, tag string) error
+	VersionAncestors(ctx context.Context, versionID string) ([]VersionInterface, error)
+	VersionAsOf(ctx context.Context, entityType string, entityID string, asOf time.Time) (VersionInterface, error)
+	VersionBranches(ctx context.Context, entityType string, entityID string) ([]string, error)
+	VersionChildren(ctx context.Context, versionID string) ([]VersionInterface, error)
+	VersionCreate(ctx context.Context, version VersionInterface, opts ...VersionCreateOptions) error
+	VersionCreateMany(ctx context.Context, versions []VersionInterface, opts ...VersionBatchOptions) error
+	VersionDiff(ctx context.Context, fromID string, toID string, format diff.Format) (*diff.Result, error)
+	VersionExpireAt(ctx context.Context, versionID string, expiresAt time.Time) error
+	VersionFindByHash(ctx context.Context, contentHash string) ([]VersionInterface, error)
 	VersionFindByID(ctx context.Context, versionID string) (VersionInterface, error)
+	VersionFindByNumber(ctx context.Context, entityType string, entityID string, versionNumber int64) (VersionInterface, error)
+	VersionFindByTag(ctx context.Context, entityType string, entityID string, tag string) (VersionInterface, error)
+	VersionFirst(ctx context.Context, entityType string, entityID string) (VersionInterface, error)
+	VersionLatest(ctx context.Context, entityType string, entityID string) (VersionInterface, error)
 	VersionList(ctx context.Context, query VersionQueryInterface) ([]VersionInterface, error)
+	VersionListByLabel(ctx context.Context, label string) ([]VersionInterface, error)
+	VersionNext(ctx context.Context, version VersionInterface) (VersionInterface, error)
+	VersionPrevious(ctx context.Context, version VersionInterface) (VersionInterface, error)
+	VersionRedactions(ctx context.Context, versionID string) ([]Redaction, error)
+	VersionRestore(ctx context.Context, versionID string, opts VersionRestoreOptions) (VersionInterface, error)
+	VersionRestoreSoftDeleted(ctx context.Context, versionID string) error
+	VersionRestoreSoftDeletedByEntity(ctx context.Context, entityType string, entityID string) (int64, error)
+	VersionTags(ctx context.Context, versionID string) ([]Tag, error)
 	VersionUpdate(ctx context.Context, version VersionInterface) error
 	VersionDelete(ctx context.Context, version VersionInterface) error
 	VersionDeleteByID(ctx context.Context, versionID string) error
+	VersionDeleteByQuery(ctx context.Context, query VersionQueryInterface, opts ...VersionDeleteByQueryOptions) (int64, error)
+	VersionDeleteMany(ctx context.Context, versionIDs []string, opts ...VersionBatchOptions) error
 	VersionSoftDelete(ctx context.Context, version VersionInterface) error
 	VersionSoftDeleteByID(ctx context.Context, versionID string) error
+	VersionSoftDeleteByQuery(ctx context.Context, query VersionQueryInterface, opts ...VersionDeleteByQueryOptions) (int64, error)
+	VersionSoftDeleteMany(ctx context.Context, versionIDs []string, opts ...VersionBatchOptions) error
 }
 
 type VersionInterface interface {
@@ -44,6 +97,38 @@ type VersionInterface interface {
 	Content() string
 	SetContent(content string) VersionInterface
 
+	ContentHash() string
+	SetContentHash(contentHash string) VersionInterface
+
+	VersionNumber() int64
+	SetVersionNumber(versionNumber int64) VersionInterface
+
+	ParentID() string
+	SetParentID(parentID string) VersionInterface
+
+	MergeParentID() string
+	SetMergeParentID(mergeParentID string) VersionInterface
+
+	Branch() string
+	SetBranch(branch string) VersionInterface
+
+	RestoredFrom() string
+	SetRestoredFrom(restoredFrom string) VersionInterface
+
+	AuthorID() string
+	SetAuthorID(authorID string) VersionInterface
+
+	Message() string
+	SetMessage(message string) VersionInterface
+
+	Meta(key string) string
+	SetMeta(key string, value string) VersionInterface
+	Metas() map[string]string
+	SetMetas(metas map[string]string) VersionInterface
+
+	ChangesetID() string
+	SetChangesetID(changesetID string) VersionInterface
+
 	GetCreatedAt() string
 	GetCreatedAtCarbon() *carbon.Carbon
 	SetCreatedAt(createdAt string) VersionInterface
@@ -51,6 +136,9 @@ type VersionInterface interface {
 	GetSoftDeletedAt() string
 	GetSoftDeletedAtCarbon() *carbon.Carbon
 	SetSoftDeletedAt(softDeletedAt string) VersionInterface
+
+	ExpiresAt() time.Time
+	SetExpiresAt(expiresAt time.Time) VersionInterface
 }
 
 type VersionQueryInterface interface {
@@ -75,6 +163,30 @@ type VersionQueryInterface interface {
 	EntityType() string
 	SetEntityType(entityType string) VersionQueryInterface
 
+	HasParentID() bool
+	ParentID() string
+	SetParentID(parentID string) VersionQueryInterface
+
+	HasBranch() bool
+	Branch() string
+	SetBranch(branch string) VersionQueryInterface
+
+	HasContentHash() bool
+	ContentHash() string
+	SetContentHash(contentHash string) VersionQueryInterface
+
+	HasVersionNumber() bool
+	VersionNumber() int64
+	SetVersionNumber(versionNumber int64) VersionQueryInterface
+
+	HasVersionNumberGreaterThan() bool
+	VersionNumberGreaterThan() int64
+	SetVersionNumberGreaterThan(versionNumber int64) VersionQueryInterface
+
+	HasVersionNumberLessThan() bool
+	VersionNumberLessThan() int64
+	SetVersionNumberLessThan(versionNumber int64) VersionQueryInterface
+
 	HasOffset() bool
 	Offset() int64
 	SetOffset(offset int64) VersionQueryInterface
@@ -94,4 +206,24 @@ type VersionQueryInterface interface {
 	HasSoftDeletedIncluded() bool
 	SoftDeletedIncluded() bool
 	SetSoftDeletedIncluded(includeSoftDeleted bool) VersionQueryInterface
+
+	HasSoftDeletedOnly() bool
+	SoftDeletedOnly() bool
+	SetSoftDeletedOnly(softDeletedOnly bool) VersionQueryInterface
+
+	HasAsOf() bool
+	AsOf() time.Time
+	SetAsOf(asOf time.Time) VersionQueryInterface
+
+	HasAuthorID() bool
+	AuthorID() string
+	SetAuthorID(authorID string) VersionQueryInterface
+
+	HasMessageContains() bool
+	MessageContains() string
+	SetMessageContains(text string) VersionQueryInterface
+
+	HasMetas() bool
+	Metas() map[string]string
+	SetMeta(key string, value string) VersionQueryInterface
 }
@@ -0,0 +1,330 @@
+package versionstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/versionstore/diff"
+)
+
+// MergeStrategy defines how the content of two versions is merged
+type MergeStrategy string
+
+const (
+	// MERGE_STRATEGY_TEXT merges the content line by line
+	MERGE_STRATEGY_TEXT MergeStrategy = "text"
+	// MERGE_STRATEGY_JSON merges the content as JSON objects, key by key
+	MERGE_STRATEGY_JSON MergeStrategy = "json"
+)
+
+// ErrMergeConflict is matched by the *MergeConflictError returned by Merge
+// when the versions cannot be merged automatically
+var ErrMergeConflict = errors.New("version store: merge conflict")
+
+// MergeConflict describes a change made differently on both sides of a merge
+type MergeConflict struct {
+	// Path is the location of the conflicting key for JSON merges, in the
+	// form "a.b.c", and empty for text merges
+	Path string
+
+	// Line is the 1-based line of the base content where the conflicting
+	// region starts for text merges, and 0 for JSON merges
+	Line int
+
+	// Base, Ours and Theirs hold the conflicting content of each side. For
+	// JSON merges they hold the encoded values, empty when the key is absent.
+	Base   string
+	Ours   string
+	Theirs string
+}
+
+// MergeConflictError is returned when a merge has conflicts
+type MergeConflictError struct {
+	Conflicts []MergeConflict
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("version store: merge conflict, %d conflicting change(s)", len(e.Conflicts))
+}
+
+// Is makes errors.Is(err, ErrMergeConflict) true for merge conflicts
+func (e *MergeConflictError) Is(target error) bool {
+	return target == ErrMergeConflict
+}
+
+// mergeContent merges ours and theirs, both derived from base, using the
+// given strategy
+func mergeContent(base string, ours string, theirs string, strategy MergeStrategy) (string, []MergeConflict, error) {
+	switch strategy {
+	case MERGE_STRATEGY_TEXT:
+		merged, conflicts := mergeText(base, ours, theirs)
+		return merged, conflicts, nil
+	case MERGE_STRATEGY_JSON:
+		return mergeJSON(base, ours, theirs)
+	default:
+		return "", nil, errors.New("version store: unknown merge strategy: " + string(strategy))
+	}
+}
+
+// == TEXT ====================================================================
+
+// mergeText performs a line based three-way merge (diff3). Regions changed
+// on only one side take that side; regions changed identically on both
+// sides are taken once; any other region is a conflict.
+func mergeText(base string, ours string, theirs string) (string, []MergeConflict) {
+	baseLines := splitLines(base)
+	ourLines := splitLines(ours)
+	theirLines := splitLines(theirs)
+
+	ourMatches := matchLines(base, ours)
+	theirMatches := matchLines(base, theirs)
+
+	merged := []string{}
+	conflicts := []MergeConflict{}
+
+	o, a, b := 0, 0, 0
+	for o < len(baseLines) || a < len(ourLines) || b < len(theirLines) {
+		// take the lines unchanged on both sides
+		stable := 0
+		for o+stable < len(baseLines) &&
+			ourMatches[o+stable] == a+stable &&
+			theirMatches[o+stable] == b+stable {
+			stable++
+		}
+		if stable > 0 {
+			merged = append(merged, baseLines[o:o+stable]...)
+			o, a, b = o+stable, a+stable, b+stable
+			continue
+		}
+
+		// find the next base line kept by both sides, which ends the
+		// changed region
+		next := o
+		for next < len(baseLines) && (ourMatches[next] < 0 || theirMatches[next] < 0) {
+			next++
+		}
+
+		nextA, nextB := len(ourLines), len(theirLines)
+		if next < len(baseLines) {
+			nextA, nextB = ourMatches[next], theirMatches[next]
+		}
+
+		baseChunk := baseLines[o:next]
+		ourChunk := ourLines[a:nextA]
+		theirChunk := theirLines[b:nextB]
+
+		switch {
+		case equalLines(ourChunk, baseChunk):
+			merged = append(merged, theirChunk...)
+		case equalLines(theirChunk, baseChunk), equalLines(ourChunk, theirChunk):
+			merged = append(merged, ourChunk...)
+		default:
+			conflicts = append(conflicts, MergeConflict{
+				Line:   o + 1,
+				Base:   strings.Join(baseChunk, "\n"),
+				Ours:   strings.Join(ourChunk, "\n"),
+				Theirs: strings.Join(theirChunk, "\n"),
+			})
+		}
+
+		o, a, b = next, nextA, nextB
+	}
+
+	return strings.Join(merged, "\n"), conflicts
+}
+
+// splitLines splits text into lines, an empty text having no lines
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
+
+// matchLines returns, for every line of from, the index of the line of to it
+// is kept as by the shortest line diff, or -1 if it was removed
+func matchLines(from string, to string) []int {
+	matches := []int{}
+
+	j := 0
+	for _, edit := range diff.Lines(from, to) {
+		switch edit.Op {
+		case diff.OP_EQUAL:
+			matches = append(matches, j)
+			j++
+		case diff.OP_DELETE:
+			matches = append(matches, -1)
+		case diff.OP_INSERT:
+			j++
+		}
+	}
+
+	return matches
+}
+
+// equalLines returns true if both slices hold the same lines
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// == JSON ====================================================================
+
+// mergeJSON performs a three-way merge of JSON objects. Keys changed on only
+// one side take that side, nested objects are merged recursively, and keys
+// changed differently on both sides are conflicts.
+func mergeJSON(base string, ours string, theirs string) (string, []MergeConflict, error) {
+	baseObject, err := decodeJSONObject(base)
+	if err != nil {
+		return "", nil, fmt.Errorf("version store: base content: %w", err)
+	}
+	ourObject, err := decodeJSONObject(ours)
+	if err != nil {
+		return "", nil, fmt.Errorf("version store: our content: %w", err)
+	}
+	theirObject, err := decodeJSONObject(theirs)
+	if err != nil {
+		return "", nil, fmt.Errorf("version store: their content: %w", err)
+	}
+
+	conflicts := []MergeConflict{}
+	merged := mergeJSONObjects("", baseObject, ourObject, theirObject, &conflicts)
+
+	encoded, err := encodeJSON(merged)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return encoded, conflicts, nil
+}
+
+// mergeJSONObjects merges the keys of three JSON objects, appending the
+// conflicting keys to conflicts
+func mergeJSONObjects(path string, base map[string]any, ours map[string]any, theirs map[string]any, conflicts *[]MergeConflict) map[string]any {
+	keys := map[string]bool{}
+	for _, object := range []map[string]any{base, ours, theirs} {
+		for key := range object {
+			keys[key] = true
+		}
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	merged := map[string]any{}
+	for _, key := range sortedKeys {
+		baseValue, inBase := base[key]
+		ourValue, inOurs := ours[key]
+		theirValue, inTheirs := theirs[key]
+
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		ourChanged := inOurs != inBase || !reflect.DeepEqual(ourValue, baseValue)
+		theirChanged := inTheirs != inBase || !reflect.DeepEqual(theirValue, baseValue)
+		sameChange := inOurs == inTheirs && reflect.DeepEqual(ourValue, theirValue)
+
+		switch {
+		case !theirChanged || sameChange:
+			if inOurs {
+				merged[key] = ourValue
+			}
+		case !ourChanged:
+			if inTheirs {
+				merged[key] = theirValue
+			}
+		default:
+			baseChild, baseIsObject := baseValue.(map[string]any)
+			ourChild, ourIsObject := ourValue.(map[string]any)
+			theirChild, theirIsObject := theirValue.(map[string]any)
+
+			if ourIsObject && theirIsObject && (baseIsObject || !inBase) {
+				merged[key] = mergeJSONObjects(keyPath, baseChild, ourChild, theirChild, conflicts)
+				continue
+			}
+
+			*conflicts = append(*conflicts, MergeConflict{
+				Path:   keyPath,
+				Base:   encodeJSONValue(baseValue, inBase),
+				Ours:   encodeJSONValue(ourValue, inOurs),
+				Theirs: encodeJSONValue(theirValue, inTheirs),
+			})
+
+			if inOurs {
+				merged[key] = ourValue
+			}
+		}
+	}
+
+	return merged
+}
+
+// decodeJSONObject decodes JSON object content, an empty content being an
+// empty object. Numbers are kept as json.Number to preserve their precision.
+func decodeJSONObject(content string) (map[string]any, error) {
+	if strings.TrimSpace(content) == "" {
+		return map[string]any{}, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+	decoder.UseNumber()
+
+	object := map[string]any{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, errors.New("content is not a JSON object")
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("content has data after the JSON object")
+	}
+
+	return object, nil
+}
+
+// encodeJSONValue encodes a JSON value for a conflict, an absent value
+// being empty
+func encodeJSONValue(value any, present bool) string {
+	if !present {
+		return ""
+	}
+
+	encoded, err := encodeJSON(value)
+	if err != nil {
+		return strconv.Quote(fmt.Sprint(value))
+	}
+
+	return encoded
+}
+
+// encodeJSON encodes a JSON value without escaping <, > and &, which
+// json.Marshal would rewrite as \u003c, \u003e and \u0026
+func encodeJSON(value any) (string, error) {
+	buffer := &bytes.Buffer{}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
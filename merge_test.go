@@ -0,0 +1,177 @@
+package versionstore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMergeText(t *testing.T) {
+	base := "title\nintro\nbody\nfooter"
+	ours := "title\nintro changed\nbody\nfooter"
+	theirs := "title\nintro\nbody\nfooter changed\nsignature"
+
+	merged, conflicts, err := mergeContent(base, ours, theirs, MERGE_STRATEGY_TEXT)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Fatal("Merge MUST NOT have conflicts. Found:", conflicts)
+	}
+
+	expected := "title\nintro changed\nbody\nfooter changed\nsignature"
+	if merged != expected {
+		t.Fatal("Merged content MUST be", expected, "Found:", merged)
+	}
+}
+
+func TestMergeText_Conflict(t *testing.T) {
+	base := "title\nintro\nbody"
+	ours := "title\nour intro\nbody"
+	theirs := "title\ntheir intro\nbody"
+
+	_, conflicts, err := mergeContent(base, ours, theirs, MERGE_STRATEGY_TEXT)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 1 {
+		t.Fatal("Merge MUST have 1 conflict. Found:", len(conflicts))
+	}
+
+	conflict := conflicts[0]
+	if conflict.Line != 2 || conflict.Base != "intro" || conflict.Ours != "our intro" || conflict.Theirs != "their intro" {
+		t.Fatal("Conflict MUST describe line 2. Found:", conflict)
+	}
+}
+
+func TestMergeText_SameChange(t *testing.T) {
+	merged, conflicts, err := mergeContent("a\nb", "a\nc", "a\nc", MERGE_STRATEGY_TEXT)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Fatal("Identical changes MUST NOT conflict. Found:", conflicts)
+	}
+
+	if merged != "a\nc" {
+		t.Fatal("Merged content MUST be a\\nc. Found:", merged)
+	}
+}
+
+func TestMergeText_LargeContents(t *testing.T) {
+	lines := []string{}
+	for i := range 20000 {
+		lines = append(lines, "line "+strconv.Itoa(i))
+	}
+	base := strings.Join(lines, "\n")
+
+	lines[10] = "our line"
+	ours := strings.Join(lines, "\n")
+
+	lines[10] = "line 10"
+	lines[19990] = "their line"
+	theirs := strings.Join(lines, "\n")
+
+	merged, conflicts, err := mergeContent(base, ours, theirs, MERGE_STRATEGY_TEXT)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Fatal("Merge MUST NOT have conflicts. Found:", conflicts)
+	}
+
+	lines[10] = "our line"
+	if merged != strings.Join(lines, "\n") {
+		t.Fatal("Merged content MUST keep both changes")
+	}
+}
+
+func TestMergeJSON(t *testing.T) {
+	base := `{"title":"Home","meta":{"author":"ann","tags":["a"]},"draft":true}`
+	ours := `{"title":"Home page","meta":{"author":"ann","tags":["a"]},"draft":true}`
+	theirs := `{"title":"Home","meta":{"author":"bob","tags":["a"]}}`
+
+	merged, conflicts, err := mergeContent(base, ours, theirs, MERGE_STRATEGY_JSON)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Fatal("Merge MUST NOT have conflicts. Found:", conflicts)
+	}
+
+	expected := `{"meta":{"author":"bob","tags":["a"]},"title":"Home page"}`
+	if merged != expected {
+		t.Fatal("Merged content MUST be", expected, "Found:", merged)
+	}
+}
+
+func TestMergeJSON_Conflict(t *testing.T) {
+	base := `{"meta":{"author":"ann"},"price":10}`
+	ours := `{"meta":{"author":"bob"},"price":10}`
+	theirs := `{"meta":{"author":"cat"}}`
+
+	_, conflicts, err := mergeContent(base, ours, theirs, MERGE_STRATEGY_JSON)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 1 {
+		t.Fatal("Merge MUST have 1 conflict. Found:", len(conflicts))
+	}
+
+	conflict := conflicts[0]
+	if conflict.Path != "meta.author" || conflict.Base != `"ann"` || conflict.Ours != `"bob"` || conflict.Theirs != `"cat"` {
+		t.Fatal("Conflict MUST describe meta.author. Found:", conflict)
+	}
+}
+
+func TestMergeJSON_InvalidContent(t *testing.T) {
+	_, _, err := mergeContent(`{}`, `[1,2]`, `{}`, MERGE_STRATEGY_JSON)
+	if err == nil {
+		t.Fatal("Merge of non object content MUST fail")
+	}
+
+	_, _, err = mergeContent(`{}`, `{"a":1} trailing`, `{}`, MERGE_STRATEGY_JSON)
+	if err == nil {
+		t.Fatal("Merge of content with data after the object MUST fail")
+	}
+
+	_, _, err = mergeContent(`{}`, `{} {}`, `{}`, MERGE_STRATEGY_JSON)
+	if err == nil {
+		t.Fatal("Merge of content with several objects MUST fail")
+	}
+}
+
+func TestMergeJSON_KeepsHTMLCharacters(t *testing.T) {
+	base := `{"body":"<p>a</p>","title":"A"}`
+	ours := `{"body":"<p>a & b</p>","title":"A"}`
+	theirs := `{"body":"<p>a</p>","title":"<b>"}`
+
+	merged, conflicts, err := mergeContent(base, ours, theirs, MERGE_STRATEGY_JSON)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Fatal("Merge MUST NOT have conflicts. Found:", conflicts)
+	}
+
+	expected := `{"body":"<p>a & b</p>","title":"<b>"}`
+	if merged != expected {
+		t.Fatal("Merged content MUST be", expected, "Found:", merged)
+	}
+}
+
+func TestMergeConflictError(t *testing.T) {
+	var err error = &MergeConflictError{Conflicts: []MergeConflict{{Path: "title"}}}
+
+	if !errors.Is(err, ErrMergeConflict) {
+		t.Fatal("MergeConflictError MUST match ErrMergeConflict")
+	}
+}
@@ -0,0 +1,147 @@
+package versionstore
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DEFAULT_PRUNE_BATCH_SIZE is the number of entities read, and of versions
+// deleted, per statement by Prune when the policy does not set a batch size,
+// deletes being capped to what a statement can bind
+const DEFAULT_PRUNE_BATCH_SIZE = 500
+
+// RetentionRules define which versions of an entity are kept. A version is
+// kept if any rule keeps it, and the latest version of an entity is always
+// kept.
+type RetentionRules struct {
+	// KeepLast keeps the most recent versions of each entity
+	KeepLast int
+
+	// KeepWithin keeps every version created within this duration
+	KeepWithin time.Duration
+
+	// KeepDaily, KeepWeekly and KeepMonthly keep the most recent version of
+	// each of the most recent days, ISO weeks and months that have versions
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+// RetentionPolicy defines the versions kept by Prune
+type RetentionPolicy struct {
+	// RetentionRules apply to every entity type without an override
+	RetentionRules
+
+	// EntityTypeRules override the rules for the given entity types
+	EntityTypeRules map[string]RetentionRules
+
+	// HardDelete deletes excess versions permanently instead of soft
+	// deleting them
+	HardDelete bool
+
+	// BatchSize is the number of entities read, and of versions deleted,
+	// per statement, defaults to DEFAULT_PRUNE_BATCH_SIZE. Deletes are
+	// capped to what a statement can bind, as each version binds its id
+	// twice.
+	BatchSize int
+}
+
+// Validate checks that every rule set keeps something, so that a missing
+// rule cannot prune an entity down to its latest version by accident
+func (policy RetentionPolicy) Validate() error {
+	if policy.BatchSize < 0 {
+		return errors.New("version store: retention policy batch size cannot be negative")
+	}
+
+	if err := policy.RetentionRules.validate(); err != nil {
+		return err
+	}
+
+	for entityType, rules := range policy.EntityTypeRules {
+		if err := rules.validate(); err != nil {
+			return errors.New(err.Error() + " for entity type " + strconv.Quote(entityType))
+		}
+	}
+
+	return nil
+}
+
+// rulesFor returns the rules applying to an entity type
+func (policy RetentionPolicy) rulesFor(entityType string) RetentionRules {
+	if rules, ok := policy.EntityTypeRules[entityType]; ok {
+		return rules
+	}
+	return policy.RetentionRules
+}
+
+// validate checks that the rules are not negative and keep something
+func (rules RetentionRules) validate() error {
+	if rules.KeepLast < 0 || rules.KeepWithin < 0 || rules.KeepDaily < 0 || rules.KeepWeekly < 0 || rules.KeepMonthly < 0 {
+		return errors.New("version store: retention rules cannot be negative")
+	}
+
+	if rules == (RetentionRules{}) {
+		return errors.New("version store: retention rules must keep something")
+	}
+
+	return nil
+}
+
+// expired returns the versions the rules do not keep. The versions must
+// belong to a single entity and be ordered newest first.
+func (rules RetentionRules) expired(versions []VersionInterface, now time.Time) []VersionInterface {
+	keep := make([]bool, len(versions))
+
+	for i, version := range versions {
+		if i == 0 || i < rules.KeepLast {
+			keep[i] = true
+		}
+		if rules.KeepWithin > 0 && version.GetCreatedAtCarbon().StdTime().After(now.Add(-rules.KeepWithin)) {
+			keep[i] = true
+		}
+	}
+
+	keepPerPeriod(versions, keep, rules.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+
+	keepPerPeriod(versions, keep, rules.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return strconv.Itoa(year) + "-W" + strconv.Itoa(week)
+	})
+
+	keepPerPeriod(versions, keep, rules.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	expired := []VersionInterface{}
+	for i, version := range versions {
+		if !keep[i] {
+			expired = append(expired, version)
+		}
+	}
+
+	return expired
+}
+
+// keepPerPeriod marks as kept the newest version of each of the count most
+// recent periods. The versions must be ordered newest first.
+func keepPerPeriod(versions []VersionInterface, keep []bool, count int, period func(t time.Time) string) {
+	if count <= 0 {
+		return
+	}
+
+	seen := map[string]bool{}
+	for i, version := range versions {
+		key := period(version.GetCreatedAtCarbon().StdTime().UTC())
+		if seen[key] {
+			continue
+		}
+		if len(seen) >= count {
+			return
+		}
+		seen[key] = true
+		keep[i] = true
+	}
+}
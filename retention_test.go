@@ -0,0 +1,108 @@
+package versionstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// retentionVersions returns versions created at the given times, newest first
+func retentionVersions(times ...string) []VersionInterface {
+	versions := []VersionInterface{}
+	for i, createdAt := range times {
+		versions = append(versions, NewVersion().
+			SetID(createdAt).
+			SetVersionNumber(int64(len(times)-i)).
+			SetCreatedAt(createdAt))
+	}
+	return versions
+}
+
+func expiredIDs(versions []VersionInterface) string {
+	ids := []string{}
+	for _, version := range versions {
+		ids = append(ids, version.ID())
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRetentionRules_KeepLast(t *testing.T) {
+	versions := retentionVersions("2024-01-04 00:00:00", "2024-01-03 00:00:00", "2024-01-02 00:00:00", "2024-01-01 00:00:00")
+	now := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	expired := RetentionRules{KeepLast: 2}.expired(versions, now)
+
+	if expiredIDs(expired) != "2024-01-02 00:00:00,2024-01-01 00:00:00" {
+		t.Fatal("KeepLast MUST keep the 2 most recent versions. Expired:", expiredIDs(expired))
+	}
+}
+
+func TestRetentionRules_KeepWithin(t *testing.T) {
+	versions := retentionVersions("2024-01-04 12:00:00", "2024-01-04 06:00:00", "2024-01-02 00:00:00")
+	now := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	expired := RetentionRules{KeepWithin: 24 * time.Hour}.expired(versions, now)
+
+	if expiredIDs(expired) != "2024-01-02 00:00:00" {
+		t.Fatal("KeepWithin MUST keep the versions of the last day. Expired:", expiredIDs(expired))
+	}
+}
+
+func TestRetentionRules_KeepPerPeriod(t *testing.T) {
+	versions := retentionVersions(
+		"2024-03-10 18:00:00",
+		"2024-03-10 09:00:00",
+		"2024-03-09 10:00:00",
+		"2024-03-01 10:00:00",
+		"2024-02-20 10:00:00",
+		"2024-02-10 10:00:00",
+		"2024-01-15 10:00:00",
+	)
+	now := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+
+	expired := RetentionRules{KeepDaily: 2}.expired(versions, now)
+
+	expected := "2024-03-10 09:00:00,2024-03-01 10:00:00,2024-02-20 10:00:00,2024-02-10 10:00:00,2024-01-15 10:00:00"
+	if expiredIDs(expired) != expected {
+		t.Fatal("KeepDaily MUST keep the newest version of the 2 last days. Expired:", expiredIDs(expired))
+	}
+
+	expired = RetentionRules{KeepMonthly: 3}.expired(versions, now)
+
+	expected = "2024-03-10 09:00:00,2024-03-09 10:00:00,2024-03-01 10:00:00,2024-02-10 10:00:00"
+	if expiredIDs(expired) != expected {
+		t.Fatal("KeepMonthly MUST keep the newest version of the 3 last months. Expired:", expiredIDs(expired))
+	}
+
+	// 2024-03-09 and 2024-03-10 share ISO week 10
+	expired = RetentionRules{KeepWeekly: 2}.expired(versions, now)
+
+	expected = "2024-03-10 09:00:00,2024-03-09 10:00:00,2024-02-20 10:00:00,2024-02-10 10:00:00,2024-01-15 10:00:00"
+	if expiredIDs(expired) != expected {
+		t.Fatal("KeepWeekly MUST keep the newest version of the 2 last weeks. Expired:", expiredIDs(expired))
+	}
+}
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	if err := (RetentionPolicy{}).Validate(); err == nil {
+		t.Fatal("Policy keeping nothing MUST be invalid")
+	}
+
+	policy := RetentionPolicy{
+		RetentionRules:  RetentionRules{KeepLast: 1},
+		EntityTypeRules: map[string]RetentionRules{"page": {}},
+	}
+	if err := policy.Validate(); err == nil {
+		t.Fatal("Override keeping nothing MUST be invalid")
+	}
+
+	policy = RetentionPolicy{RetentionRules: RetentionRules{KeepLast: -1}}
+	if err := policy.Validate(); err == nil {
+		t.Fatal("Negative rules MUST be invalid")
+	}
+
+	policy = RetentionPolicy{RetentionRules: RetentionRules{KeepLast: 1}}
+	if err := policy.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
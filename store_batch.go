@@ -0,0 +1,516 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// DEFAULT_BATCH_MAX_PARAMETERS is the most parameters a statement of the
+// batch operations binds by default: the limit of SQLite before 3.32, below
+// the 2100 of SQL Server and the 65535 of MySQL and PostgreSQL
+const DEFAULT_BATCH_MAX_PARAMETERS = 999
+
+// batchDeleteParameters is the number of parameters a version binds in the
+// statements deleting a chunk, which list its id twice
+const batchDeleteParameters = 2
+
+// VersionBatchOptions define the options of the batch operations
+type VersionBatchOptions struct {
+	// ChunkSize is the number of rows written by each statement. It
+	// defaults to, and cannot exceed, the most rows whose parameters fit in
+	// MaxParameters: 47 versions created, or 499 deleted, per statement.
+	ChunkSize int
+
+	// MaxParameters is the database's limit on statement parameters,
+	// defaults to DEFAULT_BATCH_MAX_PARAMETERS
+	MaxParameters int
+}
+
+// BatchRowError is the error of a single row of a batch operation
+type BatchRowError struct {
+	// Index is the position of the row in the batch
+	Index int
+	ID    string
+	Err   error
+}
+
+func (e BatchRowError) Error() string {
+	return "row " + strconv.Itoa(e.Index) + " (" + e.ID + "): " + e.Err.Error()
+}
+
+// BatchError is returned when rows of a batch operation are invalid. The
+// rows are validated before any is written, so nothing is written when
+// there are row errors.
+type BatchError struct {
+	Rows []BatchRowError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Rows) == 0 {
+		return "version store: invalid batch"
+	}
+
+	msg := "version store: invalid batch: " + e.Rows[0].Error()
+	if len(e.Rows) > 1 {
+		msg += " and " + strconv.Itoa(len(e.Rows)-1) + " more"
+	}
+
+	return msg
+}
+
+// Unwrap returns the errors of the rows, so that errors.Is and errors.As
+// match them
+func (e *BatchError) Unwrap() []error {
+	errs := []error{}
+	for _, row := range e.Rows {
+		errs = append(errs, row.Err)
+	}
+	return errs
+}
+
+// add records the error of a row
+func (e *BatchError) add(index int, id string, err error) {
+	e.Rows = append(e.Rows, BatchRowError{Index: index, ID: id, Err: err})
+}
+
+// orNil returns the batch error if it has rows, nil otherwise
+func (e *BatchError) orNil() error {
+	if len(e.Rows) == 0 {
+		return nil
+	}
+	return e
+}
+
+// batchChunkSize returns the number of rows of each statement of a batch
+// operation whose rows bind the given number of parameters each
+func batchChunkSize(opts []VersionBatchOptions, rowParameters int) int {
+	options := VersionBatchOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	maxParameters := options.MaxParameters
+	if maxParameters <= 0 {
+		maxParameters = DEFAULT_BATCH_MAX_PARAMETERS
+	}
+
+	chunkSize := max(1, maxParameters/rowParameters)
+	if options.ChunkSize > 0 {
+		chunkSize = min(chunkSize, options.ChunkSize)
+	}
+
+	return chunkSize
+}
+
+// versionBatch tracks, while the versions of a batch are created, the
+// versions they continue from
+type versionBatch struct {
+	// known are the versions read or created by the batch, by id
+	known map[string]VersionInterface
+
+	// depths are the delta depths of the known versions, by id
+	depths map[string]int64
+
+	// heads are the latest non soft deleted versions, by entity and branch
+	heads map[string]VersionInterface
+
+	// numbers are the latest version numbers, by entity
+	numbers map[string]int64
+
+	// collapsed are the heads the versions skipped as unchanged were
+	// collapsed into, by the id the versions were given
+	collapsed map[string]string
+}
+
+// entityKey returns the key of the entity of a version in versionBatch
+func entityKey(entityType string, entityID string) string {
+	return entityType + "\x00" + entityID
+}
+
+// VersionCreateMany creates the versions in a single transaction, writing
+// them with multi-row statements of ChunkSize rows. It behaves as
+// VersionCreate called for each version in order, so versions of the same
+// entity continue from each other. Every version is validated before any
+// is written, invalid ones being reported as a *BatchError. It fails with
+// ErrVersionConflict, creating nothing, if versions of the same entities
+// are created concurrently.
+func (store *storeImplementation) VersionCreateMany(ctx context.Context, versions []VersionInterface, opts ...VersionBatchOptions) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+
+	chunkSize := batchChunkSize(opts, len(versionInsertColumns())+1)
+
+	batchErr := &BatchError{}
+	indexes := map[string]int{}
+	for i, version := range versions {
+		if err := versionValidate(version); err != nil {
+			id := ""
+			if version != nil {
+				id = version.ID()
+			}
+			batchErr.add(i, id, err)
+			continue
+		}
+
+		if _, ok := indexes[version.ID()]; ok {
+			batchErr.add(i, version.ID(), errors.New("version store: duplicate version id"))
+			continue
+		}
+		indexes[version.ID()] = i
+	}
+	if err := batchErr.orNil(); err != nil {
+		return err
+	}
+
+	// defaults are applied once the whole batch is valid, so that a
+	// rejected batch leaves its versions as they were
+	for _, version := range versions {
+		store.versionDefaults(ctx, version)
+	}
+
+	if len(versions) == 0 {
+		return nil
+	}
+
+	return store.transaction(ctx, func(txStore *storeImplementation) error {
+		batch := &versionBatch{
+			known:     map[string]VersionInterface{},
+			depths:    map[string]int64{},
+			heads:     map[string]VersionInterface{},
+			numbers:   map[string]int64{},
+			collapsed: map[string]string{},
+		}
+
+		if err := txStore.batchCheckParents(ctx, versions, indexes, chunkSize, batch); err != nil {
+			return err
+		}
+
+		// versions created soft deleted, or scheduled to expire, delete
+		// from the history of their entity
+		checked := map[string]bool{}
+		for _, version := range versions {
+			key := entityKey(version.EntityType(), version.EntityID())
+			if version.GetSoftDeletedAt() == MAX_DATETIME || checked[key] {
+				continue
+			}
+			checked[key] = true
+
+			if err := txStore.holdCheckEntity(ctx, version.EntityType(), version.EntityID()); err != nil {
+				return err
+			}
+		}
+
+		for start := 0; start < len(versions); start += chunkSize {
+			if err := txStore.batchInsert(ctx, versions[start:min(start+chunkSize, len(versions))], batch); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// batchCheckParents reads the explicit parents of the versions of a batch,
+// reporting the versions whose parent is missing or belongs to another
+// entity. A parent created by the batch must come before its child.
+func (store *storeImplementation) batchCheckParents(ctx context.Context, versions []VersionInterface, indexes map[string]int, chunkSize int, batch *versionBatch) error {
+	missing := []string{}
+	for _, version := range versions {
+		_, inBatch := indexes[version.ParentID()]
+		if version.ParentID() != "" && !inBatch && !containsString(missing, version.ParentID()) {
+			missing = append(missing, version.ParentID())
+		}
+	}
+
+	for start := 0; start < len(missing); start += chunkSize {
+		ids := []any{}
+		for _, id := range missing[start:min(start+chunkSize, len(missing))] {
+			ids = append(ids, id)
+		}
+
+		parents, err := store.queryVersions(ctx, `SELECT * FROM `+store.tableName+
+			` WHERE `+COLUMN_ID+` IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+`)`, ids...)
+		if err != nil {
+			return err
+		}
+
+		for _, parent := range parents {
+			batch.known[parent.ID()] = parent
+			batch.depths[parent.ID()] = versionDeltaDepth(parent)
+		}
+	}
+
+	batchErr := &BatchError{}
+	for i, version := range versions {
+		if version.ParentID() == "" {
+			continue
+		}
+
+		parent := batch.known[version.ParentID()]
+		if index, ok := indexes[version.ParentID()]; ok {
+			if index >= i {
+				batchErr.add(i, version.ID(), errors.New("version store: parent version must come before it in the batch"))
+				continue
+			}
+			parent = versions[index]
+		}
+
+		if parent == nil {
+			batchErr.add(i, version.ID(), errors.New("version store: parent version not found"))
+			continue
+		}
+		if parent.EntityType() != version.EntityType() || parent.EntityID() != version.EntityID() {
+			batchErr.add(i, version.ID(), errors.New("version store: parent version belongs to another entity"))
+		}
+	}
+
+	return batchErr.orNil()
+}
+
+// batchInsert creates a chunk of the versions of a batch with a single
+// statement. It must run in the transaction of the batch.
+func (store *storeImplementation) batchInsert(ctx context.Context, versions []VersionInterface, batch *versionBatch) error {
+	if err := store.batchReadEntities(ctx, versions, batch); err != nil {
+		return err
+	}
+
+	columns := append(versionInsertColumns(), COLUMN_VERSION_NUMBER)
+	row := `(` + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + `)`
+
+	rows := []string{}
+	args := []any{}
+	for _, version := range versions {
+		branchKey := entityKey(version.EntityType(), version.EntityID()) + "\x00" + version.Branch()
+
+		if headID, ok := batch.collapsed[version.ParentID()]; ok {
+			version.SetParentID(headID)
+		}
+
+		head := batch.heads[branchKey]
+		if version.ParentID() == "" && head != nil {
+			version.SetParentID(head.ID())
+		}
+
+		if store.skipUnchangedContent && head != nil && head.ID() == version.ParentID() &&
+			head.ContentHash() == version.ContentHash() &&
+			version.MergeParentID() == "" && version.RestoredFrom() == "" {
+			batch.collapsed[version.ID()] = head.ID()
+			versionCopy(version, head)
+			continue
+		}
+
+		key := entityKey(version.EntityType(), version.EntityID())
+		batch.numbers[key]++
+		version.SetVersionNumber(batch.numbers[key])
+
+		stored := storedContent{content: version.Content()}
+		if store.blobTableName != "" {
+			if err := store.blobAcquire(ctx, version.ContentHash(), version.Content()); err != nil {
+				return err
+			}
+			stored.content = ""
+		} else if base := batch.known[version.ParentID()]; store.contentCodec != nil && base != nil {
+			var err error
+			stored, err = store.contentDelta(base.ID(), base.Content(), batch.depths[base.ID()], version.Content())
+			if err != nil {
+				return err
+			}
+		}
+
+		batch.known[version.ID()] = version
+		batch.depths[version.ID()] = stored.depth
+		if !version.IsSoftDeleted() {
+			batch.heads[branchKey] = version
+		}
+
+		stored, err := store.contentSeal(versionOwner(version), stored, store.compressor)
+		if err != nil {
+			return err
+		}
+
+		rows = append(rows, row)
+		args = append(append(args, versionInsertArgs(version, stored)...), version.VersionNumber())
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err := store.exec(ctx, `INSERT INTO `+store.tableName+` (`+strings.Join(columns, ", ")+`)`+
+		` VALUES `+strings.Join(rows, ", "), args...)
+	if err != nil && store.versionNumberTaken(err) {
+		return ErrVersionConflict
+	}
+
+	return err
+}
+
+// batchReadEntities reads the latest version numbers and the branch heads
+// of the entities of the versions not read yet
+func (store *storeImplementation) batchReadEntities(ctx context.Context, versions []VersionInterface, batch *versionBatch) error {
+	conditions := []string{}
+	args := []any{}
+	for _, version := range versions {
+		key := entityKey(version.EntityType(), version.EntityID())
+		if _, ok := batch.numbers[key]; ok {
+			continue
+		}
+
+		batch.numbers[key] = 0
+		conditions = append(conditions, `(`+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?)`)
+		args = append(args, version.EntityType(), version.EntityID())
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	where := `(` + strings.Join(conditions, " OR ") + `)`
+
+	rows, err := store.query(ctx, `SELECT `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, MAX(`+COLUMN_VERSION_NUMBER+`)`+
+		` FROM `+store.tableName+` WHERE `+where+
+		` GROUP BY `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID, args...)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var entityType, entityID string
+		var number int64
+		if err := rows.Scan(&entityType, &entityID, &number); err != nil {
+			rows.Close()
+			return err
+		}
+		batch.numbers[entityKey(entityType, entityID)] = number
+	}
+
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	now := toDateTimeString(carbon.Now(carbon.UTC))
+
+	heads, err := store.queryVersions(ctx, `SELECT * FROM `+store.tableName+` head`+
+		` WHERE `+where+` AND `+COLUMN_SOFT_DELETED_AT+` > ?`+
+		` AND `+COLUMN_VERSION_NUMBER+` = (SELECT MAX(`+COLUMN_VERSION_NUMBER+`) FROM `+store.tableName+` branch_version`+
+		` WHERE branch_version.`+COLUMN_ENTITY_TYPE+` = head.`+COLUMN_ENTITY_TYPE+
+		` AND branch_version.`+COLUMN_ENTITY_ID+` = head.`+COLUMN_ENTITY_ID+
+		` AND branch_version.`+COLUMN_BRANCH+` = head.`+COLUMN_BRANCH+
+		` AND branch_version.`+COLUMN_SOFT_DELETED_AT+` > ?)`, append(args, now, now)...)
+	if err != nil {
+		return err
+	}
+
+	for _, head := range heads {
+		batch.heads[entityKey(head.EntityType(), head.EntityID())+"\x00"+head.Branch()] = head
+		batch.known[head.ID()] = head
+		batch.depths[head.ID()] = versionDeltaDepth(head)
+	}
+
+	return nil
+}
+
+// VersionDeleteMany deletes permanently the versions with the given ids, in
+// a single transaction with statements of ChunkSize rows. Every id is
+// checked before any version is deleted, empty, duplicate and unknown ones
+// being reported as a *BatchError.
+func (store *storeImplementation) VersionDeleteMany(ctx context.Context, ids []string, opts ...VersionBatchOptions) error {
+	return store.versionDeleteMany(ctx, ids, true, opts)
+}
+
+// VersionSoftDeleteMany soft deletes the versions with the given ids, in a
+// single transaction with statements of ChunkSize rows. Every id is checked
+// before any version is soft deleted, empty, duplicate and unknown ones, as
+// well as ones already soft deleted, being reported as a *BatchError.
+func (store *storeImplementation) VersionSoftDeleteMany(ctx context.Context, ids []string, opts ...VersionBatchOptions) error {
+	return store.versionDeleteMany(ctx, ids, false, opts)
+}
+
+// versionDeleteMany deletes, or soft deletes, the versions with the given
+// ids in chunks
+func (store *storeImplementation) versionDeleteMany(ctx context.Context, ids []string, hardDelete bool, opts []VersionBatchOptions) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+
+	chunkSize := batchChunkSize(opts, batchDeleteParameters)
+
+	batchErr := &BatchError{}
+	indexes := map[string]int{}
+	for i, id := range ids {
+		if id == "" {
+			batchErr.add(i, id, errors.New("version store: version id is empty"))
+			continue
+		}
+		if _, ok := indexes[id]; ok {
+			batchErr.add(i, id, errors.New("version store: duplicate version id"))
+			continue
+		}
+		indexes[id] = i
+	}
+	if err := batchErr.orNil(); err != nil {
+		return err
+	}
+
+	return store.transaction(ctx, func(txStore *storeImplementation) error {
+		found := map[string]bool{}
+		for start := 0; start < len(ids); start += chunkSize {
+			chunk := ids[start:min(start+chunkSize, len(ids))]
+
+			args := []any{}
+			for _, id := range chunk {
+				args = append(args, id)
+			}
+
+			sqlStr := `SELECT ` + COLUMN_ID + ` FROM ` + txStore.tableName +
+				` WHERE ` + COLUMN_ID + ` IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ") + `)`
+			if !hardDelete {
+				sqlStr += ` AND ` + COLUMN_SOFT_DELETED_AT + ` > ?`
+				args = append(args, toDateTimeString(carbon.Now(carbon.UTC)))
+			}
+
+			rows, err := txStore.query(ctx, sqlStr, args...)
+			if err != nil {
+				return err
+			}
+
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return err
+				}
+				found[id] = true
+			}
+
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, id := range ids {
+			if !found[id] {
+				batchErr.add(i, id, errors.New("version store: version not found"))
+			}
+		}
+		if err := batchErr.orNil(); err != nil {
+			return err
+		}
+
+		for start := 0; start < len(ids); start += chunkSize {
+			if err := txStore.versionDeleteBatch(ctx, ids[start:min(start+chunkSize, len(ids))], hardDelete); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
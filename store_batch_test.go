@@ -0,0 +1,293 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStoreVersionCreateMany(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_batch_create",
+		AutomigrateEnabled:   true,
+		ContentCodec:         NewLineDeltaCodec(),
+		KeyframeInterval:     3,
+		SkipUnchangedContent: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	first := NewVersion().SetEntityType("record").SetEntityID("1").SetContent("line 1")
+	if err := store.VersionCreate(ctx, first); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	versions := []VersionInterface{
+		NewVersion().SetEntityType("record").SetEntityID("1").SetContent("line 1\nline 2"),
+		NewVersion().SetEntityType("record").SetEntityID("2").SetContent("other"),
+		NewVersion().SetEntityType("record").SetEntityID("1").SetContent("line 1\nline 2\nline 3"),
+		NewVersion().SetEntityType("record").SetEntityID("1").SetContent("line 1\nline 2\nline 3"),
+		NewVersion().SetEntityType("record").SetEntityID("3").SetContent("third"),
+	}
+
+	if err := store.VersionCreateMany(ctx, versions, VersionBatchOptions{ChunkSize: 2}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if versions[0].VersionNumber() != 2 || versions[0].ParentID() != first.ID() {
+		t.Fatal("Batch version MUST continue from the entity's head. Found:", versions[0].VersionNumber(), versions[0].ParentID())
+	}
+	if versions[2].VersionNumber() != 3 || versions[2].ParentID() != versions[0].ID() {
+		t.Fatal("Batch versions of an entity MUST continue from each other. Found:", versions[2].VersionNumber(), versions[2].ParentID())
+	}
+	if versions[3].ID() != versions[2].ID() {
+		t.Fatal("Batch version with unchanged content MUST be skipped. Found:", versions[3].ID())
+	}
+	if versions[1].VersionNumber() != 1 || versions[4].VersionNumber() != 1 {
+		t.Fatal("Batch versions of new entities MUST be numbered from 1")
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("record").SetOrderBy(COLUMN_ENTITY_ID+", "+COLUMN_VERSION_NUMBER))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	contents := []string{}
+	for _, version := range list {
+		contents = append(contents, version.Content())
+	}
+	if fmt.Sprintf("%q", contents) != `["line 1" "line 1\nline 2" "line 1\nline 2\nline 3" "other" "third"]` {
+		t.Fatal("Batch versions MUST be read back whole. Found:", contents)
+	}
+}
+
+func TestStoreVersionCreateManyInvalid(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_batch_invalid",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	other := NewVersion().SetEntityType("record").SetEntityID("2").SetContent("other")
+	if err := store.VersionCreate(ctx, other); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	valid := NewVersion().SetEntityType("record").SetEntityID("1").SetContent("valid")
+	err = store.VersionCreateMany(ctx, []VersionInterface{
+		valid,
+		NewVersion().SetEntityType("record").SetContent("no entity id"),
+		NewVersion().SetID(valid.ID()).SetEntityType("record").SetEntityID("1").SetContent("duplicate"),
+		nil,
+	})
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatal("Invalid batch MUST fail with a BatchError. Found:", err)
+	}
+	if len(batchErr.Rows) != 3 || batchErr.Rows[0].Index != 1 || batchErr.Rows[1].Index != 2 || batchErr.Rows[2].Index != 3 {
+		t.Fatal("BatchError MUST report every invalid row. Found:", batchErr.Rows)
+	}
+
+	if valid.Branch() != "" || valid.AuthorID() != "" || valid.ContentHash() != "" {
+		t.Fatal("Invalid batch MUST NOT apply defaults to its valid versions. Found:", valid.Branch(), valid.AuthorID(), valid.ContentHash())
+	}
+
+	err = store.VersionCreateMany(ctx, []VersionInterface{
+		valid,
+		NewVersion().SetEntityType("record").SetEntityID("1").SetParentID(other.ID()).SetContent("wrong parent"),
+	})
+	if !errors.As(err, &batchErr) || len(batchErr.Rows) != 1 || batchErr.Rows[0].Index != 1 {
+		t.Fatal("Batch version with a parent of another entity MUST be reported. Found:", err)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 1 {
+		t.Fatal("Invalid batch MUST create no versions. Found:", len(list))
+	}
+}
+
+func TestStoreVersionCreateManySkippedParent(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_batch_skipped",
+		AutomigrateEnabled:   true,
+		SkipUnchangedContent: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	head := NewVersion().SetEntityType("record").SetEntityID("1").SetContent("same")
+	if err := store.VersionCreate(ctx, head); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	unchanged := NewVersion().SetEntityType("record").SetEntityID("1").SetContent("same")
+	child := NewVersion().SetEntityType("record").SetEntityID("1").SetParentID(unchanged.ID()).SetContent("changed")
+
+	if err := store.VersionCreateMany(ctx, []VersionInterface{unchanged, child}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if unchanged.ID() != head.ID() {
+		t.Fatal("Batch version with unchanged content MUST be skipped. Found:", unchanged.ID())
+	}
+
+	stored, err := store.VersionFindByID(ctx, child.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if stored == nil || stored.ParentID() != head.ID() || child.ParentID() != head.ID() {
+		t.Fatal("Child of a skipped version MUST continue from the head it was skipped for. Found:", child.ParentID())
+	}
+}
+
+func TestStoreVersionCreateManyConflict(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_batch_conflict",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	if err := store.VersionCreate(ctx, NewVersion().SetEntityType("record").SetEntityID("1").SetContent("concurrent")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// a batch that read the entity before the concurrent version was created
+	implementation := store.(*storeImplementation)
+	batch := &versionBatch{
+		known:     map[string]VersionInterface{},
+		depths:    map[string]int64{},
+		heads:     map[string]VersionInterface{},
+		numbers:   map[string]int64{entityKey("record", "1"): 0},
+		collapsed: map[string]string{},
+	}
+
+	stale := NewVersion().SetEntityType("record").SetEntityID("1").SetContent("stale")
+	implementation.versionDefaults(ctx, stale)
+
+	if err := implementation.batchInsert(ctx, []VersionInterface{stale}, batch); !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Batch version taking a concurrent version's number MUST fail with ErrVersionConflict. Found:", err)
+	}
+}
+
+func TestStoreVersionDeleteMany(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_batch_delete",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	ids := []string{}
+	for i := range 5 {
+		version := NewVersion().SetEntityType("record").SetEntityID(fmt.Sprint(i)).SetContent("content")
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		ids = append(ids, version.ID())
+	}
+
+	err = store.VersionDeleteMany(ctx, []string{ids[0], "missing", ids[0]})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Rows) != 1 || batchErr.Rows[0].Index != 2 {
+		t.Fatal("Duplicate id MUST be reported before any lookup. Found:", err)
+	}
+
+	err = store.VersionDeleteMany(ctx, []string{ids[0], "missing"})
+	if !errors.As(err, &batchErr) || len(batchErr.Rows) != 1 || batchErr.Rows[0].ID != "missing" {
+		t.Fatal("Unknown id MUST be reported. Found:", err)
+	}
+
+	if err := store.VersionSoftDeleteMany(ctx, ids[:3], VersionBatchOptions{ChunkSize: 2}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.VersionSoftDeleteMany(ctx, ids[2:4]); !errors.As(err, &batchErr) || batchErr.Rows[0].ID != ids[2] {
+		t.Fatal("Soft deleted id MUST be reported. Found:", err)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 2 {
+		t.Fatal("Soft deleted versions MUST not be listed. Found:", len(list))
+	}
+
+	if err := store.VersionDeleteMany(ctx, ids[1:], VersionBatchOptions{ChunkSize: 3}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	list, err = store.VersionList(ctx, NewVersionQuery().SetSoftDeletedIncluded(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 1 {
+		t.Fatal("Deleted versions MUST be removed. Found:", len(list))
+	}
+}
+
+func TestBatchChunkSize(t *testing.T) {
+	insertParameters := len(versionInsertColumns()) + 1
+
+	cases := []struct {
+		opts          []VersionBatchOptions
+		rowParameters int
+		expected      int
+	}{
+		{nil, insertParameters, 47},
+		{nil, batchDeleteParameters, 499},
+		{[]VersionBatchOptions{{ChunkSize: 2}}, insertParameters, 2},
+		{[]VersionBatchOptions{{ChunkSize: 500}}, insertParameters, DEFAULT_BATCH_MAX_PARAMETERS / insertParameters},
+		{[]VersionBatchOptions{{MaxParameters: 2100}}, insertParameters, 2100 / insertParameters},
+		{[]VersionBatchOptions{{MaxParameters: 1}}, insertParameters, 1},
+	}
+
+	for _, c := range cases {
+		chunkSize := batchChunkSize(c.opts, c.rowParameters)
+		if chunkSize != c.expected {
+			t.Fatal("Chunk size MUST be", c.expected, "Found:", chunkSize)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package versionstore
+
+import (
+	"context"
+	"strings"
+
+	contractsdatabase "github.com/dracory/neat/contracts/database"
+	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	"github.com/dromara/carbon/v2"
+)
+
+// Column names for the blobs table
+const (
+	COLUMN_BLOB_HASH      = "hash"
+	COLUMN_BLOB_REF_COUNT = "ref_count"
+)
+
+// With blob storage enabled every distinct content is stored once in the
+// blobs table, keyed by its content hash and counting the versions that
+// reference it. A version row references a blob when its content column is
+// empty; rows written before blob storage was enabled keep their content
+// inline and are read as they are.
+
+// blobMigrateUp creates the blobs table when blob storage is enabled
+func (store *storeImplementation) blobMigrateUp(ctx context.Context) error {
+	if store.blobTableName == "" {
+		return nil
+	}
+
+	hasTable, err := store.schemaHasTable(ctx, store.blobTableName)
+	if err != nil {
+		return err
+	}
+	if hasTable {
+		return nil
+	}
+
+	err = store.schemaCreate(ctx, store.blobTableName, func(table contractsschema.Blueprint) {
+		table.String(COLUMN_BLOB_HASH, 64)
+		table.Primary(COLUMN_BLOB_HASH)
+		table.Text(COLUMN_CONTENT)
+		table.BigInteger(COLUMN_BLOB_REF_COUNT).Default(0)
+		table.DateTime(COLUMN_CREATED_AT)
+	})
+
+	if err != nil && store.debugEnabled {
+		store.logger.Error("MigrateUp: creating blob table failed", "error", err)
+	}
+
+	return err
+}
+
+// blobMigrateDown drops the blobs table when blob storage is enabled
+func (store *storeImplementation) blobMigrateDown(ctx context.Context) error {
+	if store.blobTableName == "" {
+		return nil
+	}
+
+	hasTable, err := store.schemaHasTable(ctx, store.blobTableName)
+	if err != nil {
+		return err
+	}
+	if !hasTable {
+		return nil
+	}
+
+	return store.schemaDrop(ctx, store.blobTableName)
+}
+
+// blobAcquire stores the content under its hash, unless it is already
+// stored, and counts one more reference to it, in a single statement so
+// that concurrent writers of the same content cannot both insert it
+func (store *storeImplementation) blobAcquire(ctx context.Context, hash string, content string) error {
+	_, err := store.exec(ctx, store.blobAcquireSQL(), hash, content, toDateTimeString(carbon.Now(carbon.UTC)))
+	return err
+}
+
+// blobAcquireSQL returns the upsert of the database dialect inserting a
+// blob with one reference, or counting one more reference to it. It binds
+// the hash, the content and the creation time.
+func (store *storeImplementation) blobAcquireSQL() string {
+	columns := COLUMN_BLOB_HASH + `, ` + COLUMN_CONTENT + `, ` + COLUMN_BLOB_REF_COUNT + `, ` + COLUMN_CREATED_AT
+
+	switch store.dialect() {
+	case contractsdatabase.DriverMysql:
+		return `INSERT INTO ` + store.blobTableName + ` (` + columns + `) VALUES (?, ?, 1, ?)` +
+			` ON DUPLICATE KEY UPDATE ` + COLUMN_BLOB_REF_COUNT + ` = ` + COLUMN_BLOB_REF_COUNT + ` + 1`
+	case contractsdatabase.DriverSqlserver:
+		return `MERGE INTO ` + store.blobTableName + ` WITH (HOLDLOCK) AS blobs` +
+			` USING (SELECT ? AS ` + COLUMN_BLOB_HASH + `, ? AS ` + COLUMN_CONTENT + `, ? AS ` + COLUMN_CREATED_AT + `) AS acquired` +
+			` ON blobs.` + COLUMN_BLOB_HASH + ` = acquired.` + COLUMN_BLOB_HASH +
+			` WHEN MATCHED THEN UPDATE SET ` + COLUMN_BLOB_REF_COUNT + ` = blobs.` + COLUMN_BLOB_REF_COUNT + ` + 1` +
+			` WHEN NOT MATCHED THEN INSERT (` + columns + `)` +
+			` VALUES (acquired.` + COLUMN_BLOB_HASH + `, acquired.` + COLUMN_CONTENT + `, 1, acquired.` + COLUMN_CREATED_AT + `);`
+	case contractsdatabase.DriverOracle:
+		return `MERGE INTO ` + store.blobTableName + ` blobs` +
+			` USING (SELECT ? AS ` + COLUMN_BLOB_HASH + `, ? AS ` + COLUMN_CONTENT + `, ? AS ` + COLUMN_CREATED_AT + ` FROM dual) acquired` +
+			` ON (blobs.` + COLUMN_BLOB_HASH + ` = acquired.` + COLUMN_BLOB_HASH + `)` +
+			` WHEN MATCHED THEN UPDATE SET blobs.` + COLUMN_BLOB_REF_COUNT + ` = blobs.` + COLUMN_BLOB_REF_COUNT + ` + 1` +
+			` WHEN NOT MATCHED THEN INSERT (` + columns + `)` +
+			` VALUES (acquired.` + COLUMN_BLOB_HASH + `, acquired.` + COLUMN_CONTENT + `, 1, acquired.` + COLUMN_CREATED_AT + `)`
+	default:
+		return `INSERT INTO ` + store.blobTableName + ` (` + columns + `) VALUES (?, ?, 1, ?)` +
+			` ON CONFLICT (` + COLUMN_BLOB_HASH + `) DO UPDATE SET ` + COLUMN_BLOB_REF_COUNT + ` = ` + store.blobTableName + `.` + COLUMN_BLOB_REF_COUNT + ` + 1`
+	}
+}
+
+// blobRelease counts one reference less to the blobs of the versions with
+// the given ids. It must run before the versions are deleted, and be
+// followed by blobCollect once they are.
+func (store *storeImplementation) blobRelease(ctx context.Context, ids []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	references := `SELECT ` + COLUMN_CONTENT_HASH + ` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_CONTENT + ` = '' AND ` + COLUMN_ID + ` IN (` + placeholders + `)`
+
+	sqlStr := `UPDATE ` + store.blobTableName +
+		` SET ` + COLUMN_BLOB_REF_COUNT + ` = ` + COLUMN_BLOB_REF_COUNT + ` - (` +
+		`SELECT COUNT(*) FROM (` + references + `) released` +
+		` WHERE released.` + COLUMN_CONTENT_HASH + ` = ` + store.blobTableName + `.` + COLUMN_BLOB_HASH + `)` +
+		` WHERE ` + COLUMN_BLOB_HASH + ` IN (` + references + `)`
+
+	args := []any{}
+	for range 2 {
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	_, err := store.exec(ctx, sqlStr, args...)
+	return err
+}
+
+// blobCollect deletes the blobs no version references anymore
+func (store *storeImplementation) blobCollect(ctx context.Context) error {
+	_, err := store.exec(ctx, `DELETE FROM `+store.blobTableName+` WHERE `+COLUMN_BLOB_REF_COUNT+` <= 0`)
+	return err
+}
+
+// blobHydrate fills the content of the versions stored as blobs
+func (store *storeImplementation) blobHydrate(ctx context.Context, versions []VersionInterface) error {
+	if store.blobTableName == "" {
+		return nil
+	}
+
+	byHash := map[string][]VersionInterface{}
+	hashes := []string{}
+	for _, version := range versions {
+		if version.Content() != "" || version.ContentHash() == "" {
+			continue
+		}
+		if _, ok := byHash[version.ContentHash()]; !ok {
+			hashes = append(hashes, version.ContentHash())
+		}
+		byHash[version.ContentHash()] = append(byHash[version.ContentHash()], version)
+	}
+
+	for start := 0; start < len(hashes); start += DEFAULT_PRUNE_BATCH_SIZE {
+		batch := hashes[start:min(start+DEFAULT_PRUNE_BATCH_SIZE, len(hashes))]
+
+		args := []any{}
+		for _, hash := range batch {
+			args = append(args, hash)
+		}
+
+		sqlStr := `SELECT ` + COLUMN_BLOB_HASH + `, ` + COLUMN_CONTENT + ` FROM ` + store.blobTableName +
+			` WHERE ` + COLUMN_BLOB_HASH + ` IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ") + `)`
+
+		if err := store.blobHydrateBatch(ctx, sqlStr, args, byHash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blobHydrateBatch runs a select of blobs and fills the content of the
+// versions referencing them
+func (store *storeImplementation) blobHydrateBatch(ctx context.Context, sqlStr string, args []any, byHash map[string][]VersionInterface) error {
+	rows, err := store.query(ctx, sqlStr, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash, content string
+		if err := rows.Scan(&hash, &content); err != nil {
+			return err
+		}
+		for _, version := range byHash[hash] {
+			version.SetContent(content)
+		}
+	}
+
+	return rows.Err()
+}
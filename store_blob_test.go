@@ -0,0 +1,175 @@
+package versionstore
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func blobRefCounts(t *testing.T, db *sql.DB, tableName string) map[string]int64 {
+	rows, err := db.Query(`SELECT hash, ref_count FROM ` + tableName)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var hash string
+		var count int64
+		if err := rows.Scan(&hash, &count); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		counts[hash] = count
+	}
+
+	return counts
+}
+
+func TestStoreBlobStorage(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_blob",
+		AutomigrateEnabled: true,
+		BlobStorageEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	page := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("shared")
+	post := NewVersion().SetEntityType("post").SetEntityID("1").SetContent("shared")
+	other := NewVersion().SetEntityType("post").SetEntityID("1").SetContent("other")
+
+	for _, version := range []VersionInterface{page, post, other} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	counts := blobRefCounts(t, db, "version_blob_blob")
+	if len(counts) != 2 || counts[contentHash("shared")] != 2 || counts[contentHash("other")] != 1 {
+		t.Fatal("Each distinct content MUST be stored once with its references. Found:", counts)
+	}
+
+	var inline string
+	if err := db.QueryRow(`SELECT content FROM version_blob WHERE id = ?`, page.ID()).Scan(&inline); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if inline != "" {
+		t.Fatal("Version row MUST NOT store the content. Found:", inline)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("post").
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 2 || list[0].Content() != "shared" || list[1].Content() != "other" {
+		t.Fatal("Listed versions MUST have their content")
+	}
+
+	if err := store.VersionDelete(ctx, page); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	counts = blobRefCounts(t, db, "version_blob_blob")
+	if counts[contentHash("shared")] != 1 {
+		t.Fatal("Hard delete MUST release the blob. Found:", counts)
+	}
+
+	if err := store.VersionSoftDelete(ctx, post); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	counts = blobRefCounts(t, db, "version_blob_blob")
+	if counts[contentHash("shared")] != 1 {
+		t.Fatal("Soft delete MUST keep the blob. Found:", counts)
+	}
+
+	purged, err := store.PurgeSoftDeleted(ctx, 0, 10)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if purged["post"] != 1 {
+		t.Fatal("Purge MUST delete the soft deleted post. Found:", purged)
+	}
+
+	counts = blobRefCounts(t, db, "version_blob_blob")
+	if len(counts) != 1 || counts[contentHash("other")] != 1 {
+		t.Fatal("Unreferenced blobs MUST be collected. Found:", counts)
+	}
+
+	if err := store.MigrateDown(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name LIKE 'version_blob%'`).Scan(&tables); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if tables != 0 {
+		t.Fatal("MigrateDown MUST drop the blob table")
+	}
+}
+
+func TestStoreBlobStorage_WithTx(t *testing.T) {
+	db := initTxDB(t)
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_blob_with_tx",
+		BlobTableName:      "version_blob_with_tx_contents",
+		AutomigrateEnabled: true,
+		BlobStorageEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	version := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("content")
+	if err := store.VersionCreate(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	txStore := store.WithTx(tx)
+
+	found, err := txStore.VersionFindByID(ctx, version.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.Content() != "content" {
+		t.Fatal("Version content MUST be read inside the transaction")
+	}
+
+	if err := txStore.VersionDelete(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	counts := blobRefCounts(t, db, "version_blob_with_tx_contents")
+	if counts[contentHash("content")] != 1 {
+		t.Fatal("Blob MUST be restored by the rollback. Found:", counts)
+	}
+}
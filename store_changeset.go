@@ -0,0 +1,417 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	neatuid "github.com/dracory/neat/support/uid"
+	"github.com/dromara/carbon/v2"
+)
+
+// Changeset groups versions of several entities created together, like a
+// page published along with its menu entry and blocks
+type Changeset struct {
+	ID      string
+	Message string
+
+	// CreatedBy is the actor of the context the changeset was committed with
+	CreatedBy string
+	CreatedAt time.Time
+
+	// Versions are the versions committed with the changeset, soft deleted
+	// ones included, ordered by entity
+	Versions []VersionInterface
+
+	// Deleted are the versions soft deleted by the changeset, ordered by
+	// entity. Only a revert deletes versions: those that created the
+	// entities of the reverted changeset.
+	Deleted []VersionInterface
+}
+
+// changesetTableName returns the name of the changesets table
+func (store *storeImplementation) changesetTableName() string {
+	return store.tableName + "_changeset"
+}
+
+// changesetDeletionTableName returns the name of the table recording the
+// versions soft deleted by each changeset
+func (store *storeImplementation) changesetDeletionTableName() string {
+	return store.tableName + "_changeset_deletion"
+}
+
+// changesetMigrateUp creates the changesets and changeset deletions tables
+func (store *storeImplementation) changesetMigrateUp(ctx context.Context) error {
+	tables := map[string]func(table contractsschema.Blueprint){
+		store.changesetTableName(): func(table contractsschema.Blueprint) {
+			table.String(COLUMN_ID, 21)
+			table.Primary(COLUMN_ID)
+			table.Text(COLUMN_MESSAGE).Nullable()
+			table.String(COLUMN_CREATED_BY, 100).Default("")
+			table.DateTime(COLUMN_CREATED_AT)
+			table.Index(COLUMN_CREATED_AT)
+		},
+		store.changesetDeletionTableName(): func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CHANGESET_ID, 21)
+			table.String(COLUMN_VERSION_ID, 21)
+			table.Primary(COLUMN_CHANGESET_ID, COLUMN_VERSION_ID)
+		},
+	}
+
+	for _, tableName := range []string{store.changesetTableName(), store.changesetDeletionTableName()} {
+		hasTable, err := store.schemaHasTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if hasTable {
+			continue
+		}
+
+		if err := store.schemaCreate(ctx, tableName, tables[tableName]); err != nil {
+			if store.debugEnabled {
+				store.logger.Error("MigrateUp: creating changeset table failed", "table", tableName, "error", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changesetMigrateDown drops the changesets and changeset deletions tables
+func (store *storeImplementation) changesetMigrateDown(ctx context.Context) error {
+	for _, tableName := range []string{store.changesetTableName(), store.changesetDeletionTableName()} {
+		hasTable, err := store.schemaHasTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if !hasTable {
+			continue
+		}
+
+		if err := store.schemaDrop(ctx, tableName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CommitChangeset creates the versions, at most one per entity, in a single
+// transaction under a new changeset. Versions without a message get the
+// message of the changeset. Every version is created, SkipUnchangedContent
+// aside, so that the changeset holds all of them.
+func (store *storeImplementation) CommitChangeset(ctx context.Context, versions []VersionInterface, message string) (*Changeset, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("version store: changeset has no versions")
+	}
+
+	entities := map[string]bool{}
+	for _, version := range versions {
+		if version == nil {
+			return nil, errors.New("version store: version cannot be nil")
+		}
+
+		key := entityKey(version.EntityType(), version.EntityID())
+		if entities[key] {
+			return nil, errors.New("version store: changeset has several versions of " + version.EntityType() + " " + version.EntityID())
+		}
+		entities[key] = true
+	}
+
+	var changeset *Changeset
+	err := store.transaction(ctx, func(txStore *storeImplementation) error {
+		var err error
+		changeset, err = txStore.changesetCommit(ctx, versions, nil, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changeset, nil
+}
+
+// ChangesetFind returns the changeset with the given id, or nil if there is
+// none
+func (store *storeImplementation) ChangesetFind(ctx context.Context, changesetID string) (*Changeset, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if changesetID == "" {
+		return nil, errors.New("version store: changeset id is required")
+	}
+
+	changesets, err := store.queryChangesets(ctx, ` WHERE `+COLUMN_ID+` = ?`, changesetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(changesets) == 0 {
+		return nil, nil
+	}
+
+	return &changesets[0], nil
+}
+
+// ChangesetList returns the changesets that committed versions of an
+// entity, oldest first
+func (store *storeImplementation) ChangesetList(ctx context.Context, entityType string, entityID string) ([]Changeset, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+
+	return store.queryChangesets(ctx, ` WHERE `+COLUMN_ID+` IN (SELECT `+COLUMN_CHANGESET_ID+` FROM `+store.tableName+
+		` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?)`, entityType, entityID)
+}
+
+// ChangesetRevert restores every entity of a changeset to its version
+// before the changeset, in a single transaction. Each entity gets a new head
+// version restoring the parent of its changeset version, and these are
+// committed as a new changeset, which is returned. The versions that
+// created entities are soft deleted instead, and listed in the Deleted
+// versions of the revert changeset; reverting that changeset creates a
+// version restoring each of them. It fails with ErrVersionConflict,
+// reverting nothing, if any entity has versions after the changeset on the
+// same branch, and fails as well when there is nothing left to revert.
+func (store *storeImplementation) ChangesetRevert(ctx context.Context, changesetID string) (*Changeset, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if changesetID == "" {
+		return nil, errors.New("version store: changeset id is required")
+	}
+
+	var revert *Changeset
+	err := store.transaction(ctx, func(txStore *storeImplementation) error {
+		changeset, err := txStore.ChangesetFind(ctx, changesetID)
+		if err != nil {
+			return err
+		}
+		if changeset == nil {
+			return errors.New("version store: changeset not found")
+		}
+
+		for _, member := range append(append([]VersionInterface{}, changeset.Versions...), changeset.Deleted...) {
+			later, err := txStore.versionFindOne(ctx, NewVersionQuery().
+				SetEntityType(member.EntityType()).
+				SetEntityID(member.EntityID()).
+				SetBranch(member.Branch()).
+				SetVersionNumberGreaterThan(member.VersionNumber()).
+				SetSoftDeletedIncluded(true))
+			if err != nil {
+				return err
+			}
+			if later != nil {
+				return ErrVersionConflict
+			}
+		}
+
+		reverts := []VersionInterface{}
+		deleted := []VersionInterface{}
+		for _, member := range changeset.Versions {
+			if member.ParentID() == "" {
+				if !member.IsSoftDeleted() {
+					deleted = append(deleted, member)
+				}
+				continue
+			}
+
+			parent, err := txStore.versionFindOne(ctx, NewVersionQuery().
+				SetID(member.ParentID()).
+				SetSoftDeletedIncluded(true))
+			if err != nil {
+				return err
+			}
+			if parent == nil {
+				return errors.New("version store: version before changeset not found: " + member.ParentID())
+			}
+
+			reverts = append(reverts, NewVersion().
+				SetEntityType(member.EntityType()).
+				SetEntityID(member.EntityID()).
+				SetBranch(member.Branch()).
+				SetRestoredFrom(parent.ID()).
+				SetContent(parent.Content()))
+		}
+
+		// the versions deleted by the changeset are brought back by new
+		// versions restoring them
+		for _, member := range changeset.Deleted {
+			reverts = append(reverts, NewVersion().
+				SetEntityType(member.EntityType()).
+				SetEntityID(member.EntityID()).
+				SetBranch(member.Branch()).
+				SetRestoredFrom(member.ID()).
+				SetContent(member.Content()))
+		}
+
+		if len(reverts) == 0 && len(deleted) == 0 {
+			return errors.New("version store: changeset has nothing to revert")
+		}
+
+		revert, err = txStore.changesetCommit(ctx, reverts, deleted, "Revert changeset "+changeset.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revert, nil
+}
+
+// changesetCommit records a changeset, creates its versions and soft
+// deletes the deleted ones. It must run in a transaction.
+func (store *storeImplementation) changesetCommit(ctx context.Context, versions []VersionInterface, deleted []VersionInterface, message string) (*Changeset, error) {
+	id := neatuid.GenerateShortID()
+
+	_, err := store.exec(ctx, `INSERT INTO `+store.changesetTableName()+
+		` (`+COLUMN_ID+`, `+COLUMN_MESSAGE+`, `+COLUMN_CREATED_BY+`, `+COLUMN_CREATED_AT+`)`+
+		` VALUES (?, ?, ?, ?)`,
+		id, message, ActorFromContext(ctx), toDateTimeString(carbon.Now(carbon.UTC)))
+	if err != nil {
+		return nil, err
+	}
+
+	// an unchanged version skipped into the head of its branch would be
+	// left out of the changeset
+	commitStore := *store
+	commitStore.skipUnchangedContent = false
+
+	for _, version := range versions {
+		version.SetChangesetID(id)
+		if version.Message() == "" {
+			version.SetMessage(message)
+		}
+
+		if err := commitStore.VersionCreate(ctx, version); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, version := range deleted {
+		if err := store.VersionSoftDelete(ctx, version); err != nil {
+			return nil, err
+		}
+
+		_, err := store.exec(ctx, `INSERT INTO `+store.changesetDeletionTableName()+
+			` (`+COLUMN_CHANGESET_ID+`, `+COLUMN_VERSION_ID+`) VALUES (?, ?)`, id, version.ID())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return store.ChangesetFind(ctx, id)
+}
+
+// queryChangesets returns the changesets matching the given where clause,
+// oldest first, with their versions
+func (store *storeImplementation) queryChangesets(ctx context.Context, where string, args ...any) ([]Changeset, error) {
+	rows, err := store.query(ctx, `SELECT `+COLUMN_ID+`, `+COLUMN_MESSAGE+`, `+COLUMN_CREATED_BY+`, `+COLUMN_CREATED_AT+
+		` FROM `+store.changesetTableName()+where+
+		` ORDER BY `+COLUMN_CREATED_AT+`, `+COLUMN_ID, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	changesets := []Changeset{}
+	for rows.Next() {
+		var changeset Changeset
+		if err := rows.Scan(&changeset.ID, &stringScanner{target: &changeset.Message},
+			&changeset.CreatedBy, &datetimeScanner{target: &changeset.CreatedAt}); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changesets = append(changesets, changeset)
+	}
+
+	err = rows.Err()
+	rows.Close()
+	if err != nil || len(changesets) == 0 {
+		return changesets, err
+	}
+
+	ids := []any{}
+	for _, changeset := range changesets {
+		ids = append(ids, changeset.ID)
+	}
+
+	versions, err := store.queryVersions(ctx, `SELECT * FROM `+store.tableName+
+		` WHERE `+COLUMN_CHANGESET_ID+` IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+`)`+
+		` ORDER BY `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_VERSION_NUMBER, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	deletions, err := store.changesetDeletions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range changesets {
+		changesets[i].Versions = []VersionInterface{}
+		for _, version := range versions {
+			if version.ChangesetID() == changesets[i].ID {
+				changesets[i].Versions = append(changesets[i].Versions, version)
+			}
+		}
+
+		changesets[i].Deleted = deletions[changesets[i].ID]
+		if changesets[i].Deleted == nil {
+			changesets[i].Deleted = []VersionInterface{}
+		}
+	}
+
+	return changesets, nil
+}
+
+// changesetDeletions returns the versions soft deleted by the changesets
+// with the given ids, by changeset id
+func (store *storeImplementation) changesetDeletions(ctx context.Context, ids []any) (map[string][]VersionInterface, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	rows, err := store.query(ctx, `SELECT `+COLUMN_CHANGESET_ID+`, `+COLUMN_VERSION_ID+
+		` FROM `+store.changesetDeletionTableName()+
+		` WHERE `+COLUMN_CHANGESET_ID+` IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	changesetIDs := map[string][]string{}
+	versionIDs := []any{}
+	for rows.Next() {
+		var changesetID, versionID string
+		if err := rows.Scan(&changesetID, &versionID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changesetIDs[versionID] = append(changesetIDs[versionID], changesetID)
+		versionIDs = append(versionIDs, versionID)
+	}
+
+	err = rows.Err()
+	rows.Close()
+	if err != nil || len(versionIDs) == 0 {
+		return map[string][]VersionInterface{}, err
+	}
+
+	versions, err := store.queryVersions(ctx, `SELECT * FROM `+store.tableName+
+		` WHERE `+COLUMN_ID+` IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(versionIDs)), ", ")+`)`+
+		` ORDER BY `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_VERSION_NUMBER, versionIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	deletions := map[string][]VersionInterface{}
+	for _, version := range versions {
+		for _, changesetID := range changesetIDs[version.ID()] {
+			deletions[changesetID] = append(deletions[changesetID], version)
+		}
+	}
+
+	return deletions, nil
+}
@@ -0,0 +1,228 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStoreChangeset(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_changeset",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	page := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("draft page")
+	menu := NewVersion().SetEntityType("menu").SetEntityID("1").SetContent("draft menu")
+	for _, version := range []VersionInterface{page, menu} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	changeset, err := store.CommitChangeset(WithActor(ctx, "editor"), []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("published page"),
+		NewVersion().SetEntityType("menu").SetEntityID("1").SetContent("published menu"),
+		NewVersion().SetEntityType("block").SetEntityID("1").SetContent("new block"),
+	}, "Publish page 1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if changeset.Message != "Publish page 1" || changeset.CreatedBy != "editor" || len(changeset.Versions) != 3 {
+		t.Fatal("Changeset MUST record its message, actor and versions. Found:", changeset)
+	}
+	for _, version := range changeset.Versions {
+		if version.ChangesetID() != changeset.ID || version.Message() != "Publish page 1" {
+			t.Fatal("Changeset versions MUST share its id and message. Found:", version.ChangesetID(), version.Message())
+		}
+	}
+
+	found, err := store.ChangesetFind(ctx, changeset.ID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || len(found.Versions) != 3 || found.Versions[0].EntityType() != "block" {
+		t.Fatal("ChangesetFind MUST return the changeset with its versions. Found:", found)
+	}
+
+	listed, err := store.ChangesetList(ctx, "menu", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(listed) != 1 || listed[0].ID != changeset.ID {
+		t.Fatal("ChangesetList MUST return the changesets of the entity. Found:", listed)
+	}
+
+	_, err = store.CommitChangeset(ctx, []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("broken page"),
+		NewVersion().SetEntityType("menu").SetContent("menu without id"),
+	}, "Broken")
+	if err == nil {
+		t.Fatal("Changeset with an invalid version MUST fail")
+	}
+
+	_, err = store.CommitChangeset(ctx, []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("a"),
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("b"),
+	}, "Twice")
+	if err == nil {
+		t.Fatal("Changeset with two versions of an entity MUST fail")
+	}
+
+	latest, err := store.VersionLatest(ctx, "page", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if latest.Content() != "published page" {
+		t.Fatal("Failed changeset MUST create no versions. Found:", latest.Content())
+	}
+
+	revert, err := store.ChangesetRevert(ctx, changeset.ID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(revert.Versions) != 2 || revert.Message != "Revert changeset "+changeset.ID {
+		t.Fatal("Revert MUST be committed as a changeset. Found:", revert)
+	}
+	if len(revert.Deleted) != 1 || revert.Deleted[0].EntityType() != "block" || !revert.Deleted[0].IsSoftDeleted() {
+		t.Fatal("Revert MUST list the versions it soft deleted. Found:", revert.Deleted)
+	}
+
+	expected := map[string]string{"page": "draft page", "menu": "draft menu"}
+	for entityType, content := range expected {
+		latest, err := store.VersionLatest(ctx, entityType, "1")
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if latest.Content() != content || latest.ChangesetID() != revert.ID {
+			t.Fatal("Revert MUST restore the version before the changeset. Found:", latest.Content())
+		}
+	}
+
+	block, err := store.VersionLatest(ctx, "block", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if block != nil {
+		t.Fatal("Revert MUST soft delete the entities created by the changeset. Found:", block.Content())
+	}
+
+	if _, err := store.ChangesetRevert(ctx, changeset.ID); !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Reverting a changeset with later versions MUST fail with ErrVersionConflict. Found:", err)
+	}
+
+	reverted, err := store.ChangesetRevert(ctx, revert.ID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(reverted.Versions) != 3 || len(reverted.Deleted) != 0 {
+		t.Fatal("Reverting the revert MUST create a version per entity. Found:", reverted)
+	}
+
+	expected = map[string]string{"page": "published page", "menu": "published menu", "block": "new block"}
+	for entityType, content := range expected {
+		latest, err := store.VersionLatest(ctx, entityType, "1")
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if latest == nil || latest.Content() != content {
+			t.Fatal("Reverting the revert MUST restore the changeset. Found:", latest)
+		}
+	}
+
+	if _, err := store.ChangesetRevert(ctx, reverted.ID); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if block, err := store.VersionLatest(ctx, "block", "1"); err != nil || block != nil {
+		t.Fatal("Reverting a restored deletion MUST soft delete the entity again. Found:", block)
+	}
+
+	edited, err := store.CommitChangeset(ctx, []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("2").SetContent("new page"),
+	}, "Add page 2")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.VersionCreate(ctx, NewVersion().SetEntityType("page").SetEntityID("2").SetContent("edited page")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := store.ChangesetRevert(ctx, edited.ID); !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Reverting the creation of an entity edited since MUST fail with ErrVersionConflict. Found:", err)
+	}
+	if latest, err := store.VersionLatest(ctx, "page", "2"); err != nil || latest == nil || latest.Content() != "edited page" {
+		t.Fatal("Failed revert MUST leave the entity untouched. Found:", latest)
+	}
+
+	created, err := store.CommitChangeset(ctx, []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("3").SetContent("new page"),
+	}, "Add page 3")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.VersionSoftDelete(ctx, created.Versions[0]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := store.ChangesetRevert(ctx, created.ID); err == nil {
+		t.Fatal("Reverting a changeset with nothing left to revert MUST fail")
+	}
+	if listed, err := store.ChangesetList(ctx, "page", "3"); err != nil || len(listed) != 1 {
+		t.Fatal("Failed revert MUST NOT commit a changeset. Found:", listed)
+	}
+
+	if _, err := store.ChangesetRevert(ctx, "missing"); err == nil {
+		t.Fatal("Reverting a missing changeset MUST fail")
+	}
+
+	distinct, err := store.CommitChangeset(ctx, []VersionInterface{
+		NewVersion().SetEntityType("a/b").SetEntityID("c").SetContent("first"),
+		NewVersion().SetEntityType("a").SetEntityID("b/c").SetContent("second"),
+	}, "Distinct entities")
+	if err != nil {
+		t.Fatal("Changeset of distinct entities MUST be committed. Found:", err)
+	}
+	if len(distinct.Versions) != 2 {
+		t.Fatal("Changeset MUST hold both versions. Found:", len(distinct.Versions))
+	}
+}
+
+func TestStoreChangeset_SkipUnchangedContent(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_changeset_skip",
+		AutomigrateEnabled:   true,
+		SkipUnchangedContent: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	if err := store.VersionCreate(ctx, NewVersion().SetEntityType("menu").SetEntityID("1").SetContent("menu")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	changeset, err := store.CommitChangeset(ctx, []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("page"),
+		NewVersion().SetEntityType("menu").SetEntityID("1").SetContent("menu"),
+	}, "Publish page 1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(changeset.Versions) != 2 {
+		t.Fatal("Changeset MUST create its unchanged versions too. Found:", len(changeset.Versions))
+	}
+}
@@ -0,0 +1,370 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// storedContent is the content of a version as written to its row
+type storedContent struct {
+	content string
+	codec   string
+	baseID  string
+	depth   int64
+
+	// compression is the name of the compressor of the content, empty if
+	// it is not compressed
+	compression string
+
+	// keyID is the id of the key the content is encrypted with, empty if
+	// it is not encrypted
+	keyID string
+}
+
+// contentEncode returns the content of a version as it is stored. With blob
+// storage the row keeps only the content hash. With a content codec the
+// content is a delta against the parent, unless the version is a keyframe.
+func (store *storeImplementation) contentEncode(ctx context.Context, version VersionInterface) (storedContent, error) {
+	stored := storedContent{content: version.Content()}
+
+	if store.blobTableName != "" {
+		stored.content = ""
+		return stored, nil
+	}
+
+	if store.contentCodec == nil || version.ParentID() == "" {
+		return stored, nil
+	}
+
+	base, err := store.versionFindOne(ctx, NewVersionQuery().
+		SetID(version.ParentID()).
+		SetSoftDeletedIncluded(true))
+	if err != nil {
+		return stored, err
+	}
+	if base == nil {
+		return stored, nil
+	}
+
+	return store.contentDelta(base.ID(), base.Content(), versionDeltaDepth(base), version.Content())
+}
+
+// contentDelta encodes content against its base, or keeps it whole if the
+// chain of deltas leading to it has reached the keyframe interval
+func (store *storeImplementation) contentDelta(baseID string, baseContent string, baseDepth int64, content string) (storedContent, error) {
+	depth := baseDepth + 1
+	if depth >= int64(store.keyframeInterval) {
+		return storedContent{content: content}, nil
+	}
+
+	delta, err := store.contentCodec.Encode(baseContent, content)
+	if err != nil {
+		return storedContent{}, err
+	}
+
+	return storedContent{
+		content: delta,
+		codec:   store.contentCodec.Name(),
+		baseID:  baseID,
+		depth:   depth,
+	}, nil
+}
+
+// versionDeltaDepth returns the number of deltas applied to read a version
+func versionDeltaDepth(v VersionInterface) int64 {
+	if stored, ok := v.(*version); ok {
+		return stored.DeltaDepthField
+	}
+	return 0
+}
+
+// deltaRow is the stored content of a version read to decode another
+type deltaRow struct {
+	content     string
+	codec       string
+	baseID      string
+	compression string
+	keyID       string
+}
+
+// contentDecode replaces the deltas read into the versions with their full
+// content, reading the chain of bases each delta was encoded against
+func (store *storeImplementation) contentDecode(ctx context.Context, versions []VersionInterface) error {
+	rows := map[string]deltaRow{}
+	for _, v := range versions {
+		if stored, ok := v.(*version); ok {
+			rows[stored.ID()] = deltaRow{content: stored.ContentField, codec: stored.ContentCodecField, baseID: stored.DeltaBaseIDField}
+		}
+	}
+
+	// read the bases missing from the result, a level of the chains at a time
+	for {
+		missing := []string{}
+		for _, row := range rows {
+			if _, ok := rows[row.baseID]; row.codec != "" && !ok && !containsString(missing, row.baseID) {
+				missing = append(missing, row.baseID)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+
+		if err := store.contentReadDeltaRows(ctx, missing, rows); err != nil {
+			return err
+		}
+
+		for _, id := range missing {
+			if _, ok := rows[id]; !ok {
+				return errors.New("version store: delta base version not found: " + id)
+			}
+		}
+	}
+
+	decoded := map[string]string{}
+	for _, v := range versions {
+		stored, ok := v.(*version)
+		if !ok || stored.ContentCodecField == "" {
+			continue
+		}
+
+		content, err := store.contentResolve(stored.ID(), rows, decoded)
+		if err != nil {
+			return err
+		}
+
+		stored.ContentField = content
+		stored.ContentCodecField = ""
+	}
+
+	return nil
+}
+
+// contentResolve returns the full content of a version by applying the
+// chain of deltas leading to it, starting from its keyframe
+func (store *storeImplementation) contentResolve(versionID string, rows map[string]deltaRow, decoded map[string]string) (string, error) {
+	chain := []string{}
+	for id := versionID; ; {
+		if _, ok := decoded[id]; ok {
+			break
+		}
+
+		row := rows[id]
+		if row.codec == "" {
+			decoded[id] = row.content
+			break
+		}
+
+		if len(chain) > len(rows) {
+			return "", errors.New("version store: delta chain loops")
+		}
+
+		chain = append(chain, id)
+		id = row.baseID
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		row := rows[chain[i]]
+
+		if store.contentCodec == nil || store.contentCodec.Name() != row.codec {
+			return "", errors.New("version store: no content codec configured for " + row.codec)
+		}
+
+		content, err := store.contentCodec.Decode(decoded[row.baseID], row.content)
+		if err != nil {
+			return "", err
+		}
+
+		decoded[chain[i]] = content
+	}
+
+	return decoded[versionID], nil
+}
+
+// contentReadDeltaRows reads the stored content of the versions with the
+// given ids into rows
+func (store *storeImplementation) contentReadDeltaRows(ctx context.Context, ids []string, rows map[string]deltaRow) error {
+	args := []any{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	sqlStr := `SELECT ` + COLUMN_ID + `, ` + COLUMN_ENTITY_TYPE + `, ` + COLUMN_ENTITY_ID + `, ` + COLUMN_CONTENT + `, ` + COLUMN_CONTENT_CODEC + `, ` + COLUMN_DELTA_BASE_ID + `, ` + COLUMN_CONTENT_COMPRESSION + `, ` + COLUMN_CONTENT_KEY_ID +
+		` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_ID + ` IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + `)`
+
+	result, err := store.query(ctx, sqlStr, args...)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	for result.Next() {
+		var owner contentOwner
+		var row deltaRow
+		if err := result.Scan(&owner.id, &owner.entityType, &owner.entityID, &row.content, &row.codec, &row.baseID, &row.compression, &row.keyID); err != nil {
+			return err
+		}
+
+		content, err := store.contentOpen(owner, row.content, row.compression, row.keyID)
+		if err != nil {
+			return err
+		}
+		row.content = content
+		row.compression = ""
+		row.keyID = ""
+
+		rows[owner.id] = row
+	}
+
+	return result.Err()
+}
+
+// contentDetach stores whole the content of the versions encoded against
+// any of the given versions, so that those can be deleted. It must run in
+// the transaction deleting them.
+func (store *storeImplementation) contentDetach(ctx context.Context, ids []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	args := []any{}
+	for range 2 {
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	dependents, err := store.queryVersions(ctx, `SELECT * FROM `+store.tableName+
+		` WHERE `+COLUMN_DELTA_BASE_ID+` IN (`+placeholders+`)`+
+		` AND `+COLUMN_ID+` NOT IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, dependent := range dependents {
+		if err := store.contentUpdate(ctx, versionOwner(dependent), storedContent{content: dependent.Content()}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// contentUpdate rewrites the stored content of a version, compressing and
+// encrypting it as the store does for new versions
+func (store *storeImplementation) contentUpdate(ctx context.Context, owner contentOwner, stored storedContent) error {
+	stored, err := store.contentSeal(owner, stored, store.compressor)
+	if err != nil {
+		return err
+	}
+
+	sqlStr := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_CONTENT + ` = ?, ` + COLUMN_CONTENT_CODEC + ` = ?, ` + COLUMN_DELTA_BASE_ID + ` = ?, ` + COLUMN_DELTA_DEPTH + ` = ?, ` + COLUMN_CONTENT_COMPRESSION + ` = ?, ` + COLUMN_CONTENT_KEY_ID + ` = ?` +
+		` WHERE ` + COLUMN_ID + ` = ?`
+
+	_, err = store.exec(ctx, sqlStr, stored.content, stored.codec, stored.baseID, stored.depth, stored.compression, stored.keyID, owner.id)
+	return err
+}
+
+// MigrateContentCodec rewrites the content of every stored version, soft
+// deleted ones included, with the store's content codec: as deltas against
+// their parent with a keyframe every KeyframeInterval versions. Deltas
+// already stored are read with the same codec, so with a KeyframeInterval
+// of 1 every version is stored whole again. Each entity is converted in its
+// own transaction. It returns the number of versions rewritten.
+func (store *storeImplementation) MigrateContentCodec(ctx context.Context) (int64, error) {
+	if ctx == nil {
+		return 0, errors.New("ctx is nil")
+	}
+	if store.blobTableName != "" {
+		return 0, errors.New("version store: content codec and blob storage cannot be combined")
+	}
+
+	entities, err := store.contentEntities(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var converted int64
+	for _, entity := range entities {
+		var count int64
+		err := store.transaction(ctx, func(txStore *storeImplementation) error {
+			var err error
+			count, err = txStore.contentConvertEntity(ctx, entity[0], entity[1])
+			return err
+		})
+		if err != nil {
+			return converted, err
+		}
+
+		converted += count
+	}
+
+	return converted, nil
+}
+
+// contentEntities returns the entity type and id of every stored entity
+func (store *storeImplementation) contentEntities(ctx context.Context) ([][2]string, error) {
+	rows, err := store.query(ctx, `SELECT DISTINCT `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+` FROM `+store.tableName+
+		` ORDER BY `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := [][2]string{}
+	for rows.Next() {
+		var entity [2]string
+		if err := rows.Scan(&entity[0], &entity[1]); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, rows.Err()
+}
+
+// contentConvertEntity rewrites the content of every version of an entity
+// with the store's content codec, parents before children
+func (store *storeImplementation) contentConvertEntity(ctx context.Context, entityType string, entityID string) (int64, error) {
+	versions, err := store.queryVersions(ctx, `SELECT * FROM `+store.tableName+
+		` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`+
+		` ORDER BY `+COLUMN_VERSION_NUMBER, entityType, entityID)
+	if err != nil {
+		return 0, err
+	}
+
+	converted := map[string]storedContent{}
+	contents := map[string]string{}
+
+	var count int64
+	for _, version := range versions {
+		stored := storedContent{content: version.Content()}
+
+		if base, ok := converted[version.ParentID()]; ok && store.contentCodec != nil {
+			stored, err = store.contentDelta(version.ParentID(), contents[version.ParentID()], base.depth, version.Content())
+			if err != nil {
+				return count, err
+			}
+		}
+
+		if err := store.contentUpdate(ctx, versionOwner(version), stored); err != nil {
+			return count, err
+		}
+
+		converted[version.ID()] = stored
+		contents[version.ID()] = version.Content()
+		count++
+	}
+
+	return count, nil
+}
+
+// containsString returns true if the slice contains the string
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package versionstore
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func codecDepths(t *testing.T, db *sql.DB, tableName string) []int64 {
+	rows, err := db.Query(`SELECT delta_depth FROM ` + tableName + ` ORDER BY version_number`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer rows.Close()
+
+	depths := []int64{}
+	for rows.Next() {
+		var depth int64
+		if err := rows.Scan(&depth); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		depths = append(depths, depth)
+	}
+
+	return depths
+}
+
+func codecContents(count int) []string {
+	lines := []string{"title", "intro", "body", "footer"}
+	contents := []string{}
+	for i := range count {
+		lines = append(lines, "line "+strconv.Itoa(i))
+		contents = append(contents, strings.Join(lines, "\n"))
+	}
+	return contents
+}
+
+func TestStoreContentCodec(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_codec",
+		AutomigrateEnabled: true,
+		ContentCodec:       NewLineDeltaCodec(),
+		KeyframeInterval:   3,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	contents := codecContents(7)
+	versions := []VersionInterface{}
+	for _, content := range contents {
+		version := NewVersion().SetEntityType("page").SetEntityID("1").SetContent(content)
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		versions = append(versions, version)
+	}
+
+	depths := codecDepths(t, db, "version_codec")
+	if fmt.Sprint(depths) != "[0 1 2 0 1 2 0]" {
+		t.Fatal("Versions MUST be stored as deltas with a keyframe every 3 versions. Found:", depths)
+	}
+
+	var stored string
+	if err := db.QueryRow(`SELECT content FROM version_codec WHERE id = ?`, versions[1].ID()).Scan(&stored); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if stored == contents[1] {
+		t.Fatal("Version MUST be stored as a delta")
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("page").
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != len(contents) {
+		t.Fatal("All versions MUST be listed. Found:", len(list))
+	}
+	for i, version := range list {
+		if version.Content() != contents[i] {
+			t.Fatalf("Version %d MUST have its full content, found %q", i+1, version.Content())
+		}
+	}
+
+	// the base of the third version is the second
+	if err := store.VersionDeleteByID(ctx, versions[1].ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.VersionFindByID(ctx, versions[2].ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.Content() != contents[2] {
+		t.Fatal("Version encoded against a deleted version MUST still be readable")
+	}
+}
+
+func TestStoreMigrateContentCodec(t *testing.T) {
+	db := initDB(":memory:")
+
+	plain, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_codec_migrate",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	contents := codecContents(4)
+	for _, content := range contents {
+		version := NewVersion().SetEntityType("page").SetEntityID("1").SetContent(content)
+		if err := plain.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:               db,
+		TableName:        "version_codec_migrate",
+		ContentCodec:     NewLineDeltaCodec(),
+		KeyframeInterval: 3,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	converted, err := store.MigrateContentCodec(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if converted != 4 {
+		t.Fatal("Every version MUST be converted. Found:", converted)
+	}
+
+	if depths := codecDepths(t, db, "version_codec_migrate"); len(depths) != 4 || depths[1] != 1 || depths[3] != 0 {
+		t.Fatal("Versions MUST be stored as deltas. Found:", depths)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for i, version := range list {
+		if version.Content() != contents[i] {
+			t.Fatalf("Version %d MUST have its full content, found %q", i+1, version.Content())
+		}
+	}
+
+	if _, err := plain.VersionList(ctx, NewVersionQuery()); err == nil {
+		t.Fatal("Reading deltas without their codec MUST fail")
+	}
+
+	whole, err := NewStore(NewStoreOptions{
+		DB:               db,
+		TableName:        "version_codec_migrate",
+		ContentCodec:     NewLineDeltaCodec(),
+		KeyframeInterval: 1,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	converted, err = whole.MigrateContentCodec(ctx)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if converted != 4 {
+		t.Fatal("Every version MUST be converted back. Found:", converted)
+	}
+
+	if depths := codecDepths(t, db, "version_codec_migrate"); fmt.Sprint(depths) != "[0 0 0 0]" {
+		t.Fatal("Versions MUST be stored whole. Found:", depths)
+	}
+
+	list, err = plain.VersionList(ctx, NewVersionQuery().
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 4 || list[3].Content() != contents[3] {
+		t.Fatal("Versions stored whole MUST be readable without a codec")
+	}
+}
+
+func TestStoreVersionList_ColumnsReadStoredContent(t *testing.T) {
+	db := initDB(":memory:")
+
+	encryptor, err := NewAESGCMEncryptor(map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}, "k1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	layered, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_columns_layered",
+		AutomigrateEnabled:   true,
+		ContentCodec:         NewLineDeltaCodec(),
+		KeyframeInterval:     3,
+		Compressor:           NewGzipCompressor(gzip.BestCompression),
+		Encryptor:            encryptor,
+		EncryptedEntityTypes: []string{"doc"},
+		ContentHashKey:       []byte("hash key"),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	blob, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_columns_blob",
+		AutomigrateEnabled: true,
+		BlobStorageEnabled: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for _, store := range []StoreInterface{layered, blob} {
+		contents := []string{strings.Repeat("line 1\n", 50), strings.Repeat("line 1\n", 50) + "line 2"}
+		for _, content := range contents {
+			if err := store.VersionCreate(ctx, NewVersion().SetEntityType("doc").SetEntityID("1").SetContent(content)); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+		}
+
+		list, err := store.VersionList(ctx, NewVersionQuery().
+			SetColumns([]string{COLUMN_VERSION_NUMBER, COLUMN_CONTENT}).
+			SetOrderBy(COLUMN_VERSION_NUMBER).
+			SetSortOrder("asc"))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if len(list) != 2 || list[0].Content() != contents[0] || list[1].Content() != contents[1] {
+			t.Fatal("Selected content MUST be read whole. Found:", list)
+		}
+	}
+}
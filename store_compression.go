@@ -0,0 +1,188 @@
+package versionstore
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+)
+
+// DEFAULT_RECOMPRESS_BATCH_SIZE is the number of versions rewritten per
+// transaction by Recompress
+const DEFAULT_RECOMPRESS_BATCH_SIZE = 500
+
+// contentCompress compresses stored content with the given compressor. The
+// compressed bytes are base64 encoded to fit the text content column. The
+// content is kept uncompressed when compressing does not make it smaller.
+func (store *storeImplementation) contentCompress(stored storedContent, compressor Compressor) (storedContent, error) {
+	if compressor == nil || stored.compression != "" {
+		return stored, nil
+	}
+
+	compressed, err := compressor.Compress([]byte(stored.content))
+	if err != nil {
+		return stored, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(compressed)
+	if len(encoded) >= len(stored.content) {
+		return stored, nil
+	}
+
+	stored.content = encoded
+	stored.compression = compressor.Name()
+
+	return stored, nil
+}
+
+// builtinCompressors read the rows compressed by the compressors of this
+// package, whatever the store's compressor. They are shared so that the
+// zstd decoder is created once.
+var builtinCompressors = []Compressor{NewGzipCompressor(gzip.DefaultCompression), NewZstdCompressor(3)}
+
+// decompress returns the content stored compressed with the named
+// compressor. Besides the store's compressor, gzip, zstd and the given
+// compressors can always be read.
+func (store *storeImplementation) decompress(content string, compression string, compressors ...Compressor) (string, error) {
+	if compression == "" {
+		return content, nil
+	}
+
+	compressors = append(compressors, store.compressor)
+	compressors = append(compressors, builtinCompressors...)
+
+	for _, compressor := range compressors {
+		if compressor == nil || compressor.Name() != compression {
+			continue
+		}
+
+		compressed, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return "", err
+		}
+
+		data, err := compressor.Decompress(compressed)
+		if err != nil {
+			return "", err
+		}
+
+		return string(data), nil
+	}
+
+	return "", errors.New("version store: no compressor configured for " + compression)
+}
+
+// Recompress rewrites the content of every stored version, soft deleted
+// ones included, with the given compressor, or uncompressed if it is nil.
+// Rows are rewritten a batch at a time, each batch in its own transaction.
+// It returns the number of versions rewritten.
+func (store *storeImplementation) Recompress(ctx context.Context, compressor Compressor) (int64, error) {
+	if ctx == nil {
+		return 0, errors.New("ctx is nil")
+	}
+	if store.blobTableName != "" {
+		return 0, errors.New("version store: compression and blob storage cannot be combined")
+	}
+
+	target := ""
+	if compressor != nil {
+		target = compressor.Name()
+	}
+
+	sqlStr := `SELECT ` + COLUMN_ID + `, ` + COLUMN_ENTITY_TYPE + `, ` + COLUMN_ENTITY_ID + `, ` + COLUMN_CONTENT + `, ` + COLUMN_CONTENT_COMPRESSION + `, ` + COLUMN_CONTENT_KEY_ID +
+		` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_ID + ` > ?` +
+		` ORDER BY ` + COLUMN_ID +
+		` LIMIT ?`
+
+	updateSQL := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_CONTENT + ` = ?, ` + COLUMN_CONTENT_COMPRESSION + ` = ?, ` + COLUMN_CONTENT_KEY_ID + ` = ?` +
+		` WHERE ` + COLUMN_ID + ` = ?`
+
+	var rewritten int64
+	lastID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return rewritten, err
+		}
+
+		done := false
+		var batch int64
+		err := store.transaction(ctx, func(txStore *storeImplementation) error {
+			rows, err := txStore.recompressRows(ctx, sqlStr, lastID, DEFAULT_RECOMPRESS_BATCH_SIZE)
+			if err != nil {
+				return err
+			}
+
+			done = len(rows) < DEFAULT_RECOMPRESS_BATCH_SIZE
+
+			for _, row := range rows {
+				lastID = row.owner.id
+
+				if row.compression == target {
+					continue
+				}
+
+				content, err := txStore.contentOpen(row.owner, row.content, row.compression, row.keyID, compressor)
+				if err != nil {
+					return err
+				}
+
+				stored, err := txStore.contentSeal(row.owner, storedContent{content: content}, compressor)
+				if err != nil {
+					return err
+				}
+
+				// content the compressor does not make smaller stays as it is
+				if stored.compression == row.compression {
+					continue
+				}
+
+				if _, err := txStore.exec(ctx, updateSQL, stored.content, stored.compression, stored.keyID, row.owner.id); err != nil {
+					return err
+				}
+
+				batch++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+
+		rewritten += batch
+
+		if done {
+			return rewritten, nil
+		}
+	}
+}
+
+// recompressRow is the stored content of a version read by Recompress
+type recompressRow struct {
+	owner       contentOwner
+	content     string
+	compression string
+	keyID       string
+}
+
+// recompressRows reads a batch of stored contents, after the given id
+func (store *storeImplementation) recompressRows(ctx context.Context, sqlStr string, afterID string, limit int) ([]recompressRow, error) {
+	result, err := store.query(ctx, sqlStr, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	rows := []recompressRow{}
+	for result.Next() {
+		var row recompressRow
+		if err := result.Scan(&row.owner.id, &row.owner.entityType, &row.owner.entityID, &row.content, &row.compression, &row.keyID); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, result.Err()
+}
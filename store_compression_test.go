@@ -0,0 +1,261 @@
+package versionstore
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStoreCompression(t *testing.T) {
+	db := initDB(":memory:")
+
+	plain, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_compression",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:         db,
+		TableName:  "version_compression",
+		Compressor: NewGzipCompressor(gzip.BestCompression),
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	snapshot := `{"items":[` + strings.Repeat(`{"title":"item","published":true},`, 50) + `{}]}`
+
+	old := NewVersion().SetEntityType("page").SetEntityID("1").SetContent(snapshot)
+	if err := plain.VersionCreate(ctx, old); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	compressed := NewVersion().SetEntityType("page").SetEntityID("1").SetContent(snapshot + " ")
+	if err := store.VersionCreate(ctx, compressed); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	small := NewVersion().SetEntityType("page").SetEntityID("2").SetContent("{}")
+	if err := store.VersionCreate(ctx, small); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	compressions := map[string]string{}
+	lengths := map[string]int{}
+	rows, err := db.Query(`SELECT id, content, content_compression FROM version_compression`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for rows.Next() {
+		var id, content, compression string
+		if err := rows.Scan(&id, &content, &compression); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		compressions[id] = compression
+		lengths[id] = len(content)
+	}
+	rows.Close()
+
+	if compressions[old.ID()] != "" || compressions[compressed.ID()] != "gzip" || compressions[small.ID()] != "" {
+		t.Fatal("Rows MUST be tagged with their compression. Found:", compressions)
+	}
+	if lengths[compressed.ID()] >= len(snapshot) {
+		t.Fatal("Compressed content MUST be smaller. Found:", lengths[compressed.ID()])
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("page").
+		SetEntityID("1").
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 2 || list[0].Content() != snapshot || list[1].Content() != snapshot+" " {
+		t.Fatal("Compressed and uncompressed versions MUST both be readable")
+	}
+
+	// the store without a compressor still reads gzip
+	found, err := plain.VersionFindByID(ctx, compressed.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.Content() != snapshot+" " {
+		t.Fatal("Gzip compressed versions MUST be readable without a compressor")
+	}
+
+	rewritten, err := store.Recompress(ctx, NewGzipCompressor(gzip.BestSpeed))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if rewritten != 1 {
+		t.Fatal("Only the uncompressed compressible version MUST be rewritten. Found:", rewritten)
+	}
+
+	rewritten, err = store.Recompress(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if rewritten != 2 {
+		t.Fatal("Every compressed version MUST be rewritten. Found:", rewritten)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM version_compression WHERE content_compression <> ''`).Scan(&count); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if count != 0 {
+		t.Fatal("Every version MUST be stored uncompressed. Found:", count)
+	}
+
+	found, err = plain.VersionFindByID(ctx, compressed.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.Content() != snapshot+" " {
+		t.Fatal("Decompressed version MUST keep its content")
+	}
+}
+
+func TestStoreCompressionZstd(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_compression_zstd",
+		AutomigrateEnabled: true,
+		Compressor:         NewZstdCompressor(19),
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	plain, err := NewStore(NewStoreOptions{
+		DB:        db,
+		TableName: "version_compression_zstd",
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	snapshot := `{"items":[` + strings.Repeat(`{"title":"item","published":true},`, 50) + `{}]}`
+
+	version := NewVersion().SetEntityType("page").SetEntityID("1").SetContent(snapshot)
+	if err := store.VersionCreate(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var content, compression string
+	if err := db.QueryRow(`SELECT content, content_compression FROM version_compression_zstd`).Scan(&content, &compression); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if compression != "zstd" || len(content) >= len(snapshot) {
+		t.Fatal("Row MUST be stored compressed with zstd. Found:", compression, len(content))
+	}
+
+	// the store without a compressor still reads zstd
+	found, err := plain.VersionFindByID(ctx, version.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.Content() != snapshot {
+		t.Fatal("Zstd compressed versions MUST be readable without a compressor")
+	}
+
+	rewritten, err := store.Recompress(ctx, NewGzipCompressor(gzip.BestCompression))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if rewritten != 1 {
+		t.Fatal("Zstd compressed version MUST be rewritten with gzip. Found:", rewritten)
+	}
+}
+
+func TestZstdCompressor_Concurrent(t *testing.T) {
+	compressor := NewZstdCompressor(3)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			data := []byte(strings.Repeat("content "+strconv.Itoa(i)+" ", 100))
+
+			compressed, err := compressor.Compress(data)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			decompressed, err := compressor.Decompress(compressed)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if string(decompressed) != string(data) {
+				errs <- errors.New("round trip of content " + strconv.Itoa(i) + " differs")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal("Shared zstd compressor MUST round trip concurrent calls. Found:", err)
+	}
+}
+
+func TestStoreCompressionWithContentCodec(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_compression_codec",
+		AutomigrateEnabled: true,
+		ContentCodec:       NewLineDeltaCodec(),
+		Compressor:         NewGzipCompressor(gzip.DefaultCompression),
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	contents := []string{
+		strings.Repeat("a repeated line\n", 40),
+		strings.Repeat("a repeated line\n", 40) + "an added line",
+	}
+	for _, content := range contents {
+		if err := store.VersionCreate(ctx, NewVersion().SetEntityType("page").SetEntityID("1").SetContent(content)); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	latest, err := store.VersionLatest(ctx, "page", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if latest == nil || latest.Content() != contents[1] {
+		t.Fatal("Delta encoded against a compressed keyframe MUST be readable")
+	}
+}
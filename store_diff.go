@@ -0,0 +1,36 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dracory/versionstore/diff"
+)
+
+// VersionDiff compares the content of two versions using the given format
+func (store *storeImplementation) VersionDiff(ctx context.Context, fromID string, toID string, format diff.Format) (*diff.Result, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if fromID == "" || toID == "" {
+		return nil, errors.New("version store: from and to version ids are required")
+	}
+
+	from, err := store.VersionFindByID(ctx, fromID)
+	if err != nil {
+		return nil, err
+	}
+	if from == nil {
+		return nil, errors.New("version store: from version not found")
+	}
+
+	to, err := store.VersionFindByID(ctx, toID)
+	if err != nil {
+		return nil, err
+	}
+	if to == nil {
+		return nil, errors.New("version store: to version not found")
+	}
+
+	return diff.Diff(from.Content(), to.Content(), format)
+}
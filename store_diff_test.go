@@ -0,0 +1,55 @@
+package versionstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dracory/versionstore/diff"
+)
+
+func TestStoreVersionDiff(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_diff",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	from := NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent(`{"title":"Home"}`)
+	to := NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent(`{"title":"Home page"}`)
+
+	for _, version := range []VersionInterface{from, to} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	result, err := store.VersionDiff(ctx, from.ID(), to.ID(), diff.FORMAT_JSON_PATCH)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if result.String() != `[{"op":"replace","path":"/title","value":"Home page"}]` {
+		t.Fatal("Diff MUST replace the title. Found:", result.String())
+	}
+
+	result, err = store.VersionDiff(ctx, from.ID(), to.ID(), diff.FORMAT_UNIFIED)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(result.Hunks) != 1 {
+		t.Fatal("Diff MUST have 1 hunk. Found:", len(result.Hunks))
+	}
+
+	if _, err := store.VersionDiff(ctx, from.ID(), "missing", diff.FORMAT_UNIFIED); err == nil {
+		t.Fatal("Diff with a missing version MUST fail")
+	}
+}
@@ -0,0 +1,271 @@
+package versionstore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// DEFAULT_ROTATE_KEYS_BATCH_SIZE is the number of versions re-encrypted per
+// transaction by RotateKeys
+const DEFAULT_ROTATE_KEYS_BATCH_SIZE = 500
+
+// contentOwner identifies the row of a version its content is stored in.
+// Encrypted content is bound to it, so that it cannot be decrypted once
+// copied to another row.
+type contentOwner struct {
+	id         string
+	entityType string
+	entityID   string
+}
+
+// versionOwner returns the owner of the content of the version
+func versionOwner(version VersionInterface) contentOwner {
+	return contentOwner{id: version.ID(), entityType: version.EntityType(), entityID: version.EntityID()}
+}
+
+// associatedData returns the additional data encrypted content is
+// authenticated with
+func (owner contentOwner) associatedData() []byte {
+	return []byte(owner.id + "\x00" + owner.entityType + "\x00" + owner.entityID)
+}
+
+// contentSeal prepares stored content to be written to the row of the
+// given owner: compressed with the given compressor, then encrypted if the
+// entity type is encrypted
+func (store *storeImplementation) contentSeal(owner contentOwner, stored storedContent, compressor Compressor) (storedContent, error) {
+	stored, err := store.contentCompress(stored, compressor)
+	if err != nil {
+		return stored, err
+	}
+
+	if store.encryptor == nil || !store.encryptedEntityTypes[owner.entityType] {
+		return stored, nil
+	}
+
+	keyID := store.encryptor.KeyID()
+
+	encrypted, err := store.encryptor.Encrypt(keyID, []byte(stored.content), owner.associatedData())
+	if err != nil {
+		return stored, err
+	}
+
+	stored.content = base64.StdEncoding.EncodeToString(encrypted)
+	stored.keyID = keyID
+
+	return stored, nil
+}
+
+// contentOpen returns the content stored in the row of the given owner,
+// decrypting and then decompressing it
+func (store *storeImplementation) contentOpen(owner contentOwner, content string, compression string, keyID string, compressors ...Compressor) (string, error) {
+	content, err := store.decrypt(owner, content, keyID)
+	if err != nil {
+		return "", err
+	}
+
+	return store.decompress(content, compression, compressors...)
+}
+
+// contentOpenVersions decrypts and decompresses the content read into the
+// versions
+func (store *storeImplementation) contentOpenVersions(versions []VersionInterface) error {
+	for _, v := range versions {
+		stored, ok := v.(*version)
+		if !ok || (stored.ContentCompressionField == "" && stored.ContentKeyIDField == "") {
+			continue
+		}
+
+		content, err := store.contentOpen(versionOwner(stored), stored.ContentField, stored.ContentCompressionField, stored.ContentKeyIDField)
+		if err != nil {
+			return err
+		}
+
+		stored.ContentField = content
+		stored.ContentCompressionField = ""
+		stored.ContentKeyIDField = ""
+	}
+
+	return nil
+}
+
+// decrypt returns the content stored in the row of the given owner
+// encrypted with the key with the given id, or the content itself if the
+// id is empty
+func (store *storeImplementation) decrypt(owner contentOwner, content string, keyID string) (string, error) {
+	if keyID == "" {
+		return content, nil
+	}
+
+	if store.encryptor == nil {
+		return "", errors.New("version store: no encryptor configured for key " + keyID)
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := store.encryptor.Decrypt(keyID, encrypted, owner.associatedData())
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// RotateKeys re-encrypts the content of the versions encrypted with the key
+// oldKeyID with the key newKeyID, soft deleted versions included. With an
+// empty oldKeyID it encrypts instead the versions of the encrypted entity
+// types stored in plaintext, written before their entity type was
+// encrypted, and keys their content hash. Rows are re-encrypted a batch at
+// a time, each batch in its own transaction, so an interrupted rotation can
+// simply be run again. It returns the number of versions re-encrypted.
+func (store *storeImplementation) RotateKeys(ctx context.Context, oldKeyID string, newKeyID string) (int64, error) {
+	if ctx == nil {
+		return 0, errors.New("ctx is nil")
+	}
+	if store.encryptor == nil {
+		return 0, errors.New("version store: no encryptor configured")
+	}
+	if newKeyID == "" {
+		return 0, errors.New("version store: new key id is required")
+	}
+	if oldKeyID == newKeyID {
+		return 0, errors.New("version store: old and new key ids are the same")
+	}
+
+	plaintext := oldKeyID == ""
+
+	where := COLUMN_CONTENT_KEY_ID + ` = ?`
+	args := []any{oldKeyID}
+	if plaintext {
+		entityTypes := []string{}
+		for entityType := range store.encryptedEntityTypes {
+			entityTypes = append(entityTypes, entityType)
+		}
+		sort.Strings(entityTypes)
+
+		where += ` AND ` + COLUMN_ENTITY_TYPE + ` IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(entityTypes)), ", ") + `)`
+		for _, entityType := range entityTypes {
+			args = append(args, entityType)
+		}
+	}
+
+	sqlStr := `SELECT ` + COLUMN_ID + `, ` + COLUMN_ENTITY_TYPE + `, ` + COLUMN_ENTITY_ID + `, ` + COLUMN_CONTENT +
+		` FROM ` + store.tableName +
+		` WHERE ` + where + ` AND ` + COLUMN_ID + ` > ?` +
+		` ORDER BY ` + COLUMN_ID +
+		` LIMIT ?`
+
+	updateSQL := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_CONTENT + ` = ?, ` + COLUMN_CONTENT_KEY_ID + ` = ?` +
+		` WHERE ` + COLUMN_ID + ` = ?`
+
+	hashSQL := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_CONTENT_HASH + ` = ?` +
+		` WHERE ` + COLUMN_ID + ` = ?`
+
+	var rotated int64
+	lastID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return rotated, err
+		}
+
+		done := false
+		var batch int64
+		err := store.transaction(ctx, func(txStore *storeImplementation) error {
+			rows, err := txStore.keyRows(ctx, sqlStr, args, lastID)
+			if err != nil {
+				return err
+			}
+
+			done = len(rows) < DEFAULT_ROTATE_KEYS_BATCH_SIZE
+
+			if len(rows) == 0 {
+				return nil
+			}
+
+			// the hash is of the whole content, which plaintext rows
+			// stored as deltas or compressed do not hold as is
+			hashes := map[string]string{}
+			if plaintext {
+				ids := []any{}
+				for _, row := range rows {
+					ids = append(ids, row.owner.id)
+				}
+
+				versions, err := txStore.queryVersions(ctx, `SELECT * FROM `+txStore.tableName+
+					` WHERE `+COLUMN_ID+` IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+`)`, ids...)
+				if err != nil {
+					return err
+				}
+
+				for _, version := range versions {
+					hashes[version.ID()] = txStore.versionContentHash(version.EntityType(), version.Content())
+				}
+			}
+
+			for _, row := range rows {
+				lastID = row.owner.id
+
+				content, err := txStore.decrypt(row.owner, row.content, oldKeyID)
+				if err != nil {
+					return err
+				}
+
+				encrypted, err := txStore.encryptor.Encrypt(newKeyID, []byte(content), row.owner.associatedData())
+				if err != nil {
+					return err
+				}
+
+				if _, err := txStore.exec(ctx, updateSQL, base64.StdEncoding.EncodeToString(encrypted), newKeyID, row.owner.id); err != nil {
+					return err
+				}
+
+				if plaintext {
+					if _, err := txStore.exec(ctx, hashSQL, hashes[row.owner.id], row.owner.id); err != nil {
+						return err
+					}
+				}
+
+				batch++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return rotated, err
+		}
+
+		rotated += batch
+
+		if done {
+			return rotated, nil
+		}
+	}
+}
+
+// keyRows reads the owner and content of a batch of versions matching the
+// arguments of the query, after the given id
+func (store *storeImplementation) keyRows(ctx context.Context, sqlStr string, args []any, afterID string) ([]recompressRow, error) {
+	result, err := store.query(ctx, sqlStr, append(append([]any{}, args...), afterID, DEFAULT_ROTATE_KEYS_BATCH_SIZE)...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	rows := []recompressRow{}
+	for result.Next() {
+		var row recompressRow
+		if err := result.Scan(&row.owner.id, &row.owner.entityType, &row.owner.entityID, &row.content); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, result.Err()
+}
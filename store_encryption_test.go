@@ -0,0 +1,314 @@
+package versionstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStoreEncryption(t *testing.T) {
+	db := initDB(":memory:")
+
+	keys := map[string][]byte{
+		"old": bytes.Repeat([]byte("o"), 32),
+		"new": bytes.Repeat([]byte("n"), 32),
+	}
+
+	oldEncryptor, err := NewAESGCMEncryptor(keys, "old")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_encryption",
+		AutomigrateEnabled:   true,
+		Encryptor:            oldEncryptor,
+		EncryptedEntityTypes: []string{"customer"},
+		ContentHashKey:       []byte("hash key"),
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for _, version := range []VersionInterface{
+		NewVersion().SetEntityType("customer").SetEntityID("1").SetContent("jane@example.com"),
+		NewVersion().SetEntityType("customer").SetEntityID("1").SetContent("jane.doe@example.com"),
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("public"),
+	} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	keyIDs := map[string]bool{}
+	rows, err := db.Query(`SELECT entity_type, content, content_key_id FROM version_encryption`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	for rows.Next() {
+		var entityType, content, keyID string
+		if err := rows.Scan(&entityType, &content, &keyID); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if entityType == "customer" && strings.Contains(content, "example.com") {
+			t.Fatal("Encrypted entity type MUST NOT be stored in plaintext. Found:", content)
+		}
+		keyIDs[entityType+":"+keyID] = true
+	}
+	rows.Close()
+
+	if !keyIDs["customer:old"] {
+		t.Fatal("Customer versions MUST be encrypted with the current key. Found:", keyIDs)
+	}
+	if !keyIDs["page:"] {
+		t.Fatal("Page versions MUST NOT be encrypted. Found:", keyIDs)
+	}
+
+	latest, err := store.VersionLatest(ctx, "customer", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if latest == nil || latest.Content() != "jane.doe@example.com" {
+		t.Fatal("Encrypted version MUST be read decrypted")
+	}
+
+	if latest.ContentHash() == contentHash("jane.doe@example.com") {
+		t.Fatal("Content hash of an encrypted entity type MUST be keyed")
+	}
+
+	if page, err := store.VersionLatest(ctx, "page", "1"); err != nil || page.ContentHash() != contentHash("public") {
+		t.Fatal("Content hash of an entity type not encrypted MUST be plain SHA-256")
+	}
+
+	plain, err := NewStore(NewStoreOptions{
+		DB:        db,
+		TableName: "version_encryption",
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := plain.VersionLatest(ctx, "customer", "1"); err == nil {
+		t.Fatal("Reading encrypted versions without the encryptor MUST fail")
+	}
+
+	if page, err := plain.VersionLatest(ctx, "page", "1"); err != nil || page.Content() != "public" {
+		t.Fatal("Versions not encrypted MUST be readable without the encryptor")
+	}
+
+	newEncryptor, err := NewAESGCMEncryptor(keys, "new")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	rotating, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_encryption",
+		Encryptor:            newEncryptor,
+		EncryptedEntityTypes: []string{"customer"},
+		ContentHashKey:       []byte("hash key"),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	rotated, err := rotating.RotateKeys(ctx, "old", "new")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if rotated != 2 {
+		t.Fatal("Both customer versions MUST be re-encrypted. Found:", rotated)
+	}
+
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM version_encryption WHERE content_key_id = 'old'`).Scan(&remaining); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if remaining != 0 {
+		t.Fatal("No version MUST remain encrypted with the old key. Found:", remaining)
+	}
+
+	onlyNew, err := NewAESGCMEncryptor(map[string][]byte{"new": keys["new"]}, "new")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	newOnly, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_encryption",
+		Encryptor:            onlyNew,
+		EncryptedEntityTypes: []string{"customer"},
+		ContentHashKey:       []byte("hash key"),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	first, err := newOnly.VersionFirst(ctx, "customer", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if first == nil || first.Content() != "jane@example.com" {
+		t.Fatal("Re-encrypted version MUST be readable with the new key only")
+	}
+}
+
+func TestStoreEncryption_BoundToRow(t *testing.T) {
+	db := initDB(":memory:")
+
+	encryptor, err := NewAESGCMEncryptor(map[string][]byte{"key": bytes.Repeat([]byte("k"), 32)}, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_encryption_row",
+		AutomigrateEnabled:   true,
+		Encryptor:            encryptor,
+		EncryptedEntityTypes: []string{"customer"},
+		ContentHashKey:       []byte("hash key"),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	jane := NewVersion().SetEntityType("customer").SetEntityID("1").SetContent("jane@example.com")
+	john := NewVersion().SetEntityType("customer").SetEntityID("2").SetContent("john@example.com")
+	for _, version := range []VersionInterface{jane, john} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	_, err = db.Exec(`UPDATE version_encryption_row SET content = (SELECT content FROM version_encryption_row WHERE id = ?) WHERE id = ?`, jane.ID(), john.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := store.VersionFindByID(ctx, john.ID()); err == nil {
+		t.Fatal("Content copied from another row MUST NOT be decrypted")
+	}
+
+	if found, err := store.VersionFindByID(ctx, jane.ID()); err != nil || found.Content() != "jane@example.com" {
+		t.Fatal("Content in its own row MUST be decrypted")
+	}
+}
+
+func TestStoreRotateKeys_Plaintext(t *testing.T) {
+	db := initDB(":memory:")
+
+	plain, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_encryption_plaintext",
+		AutomigrateEnabled: true,
+		ContentCodec:       NewLineDeltaCodec(),
+		Compressor:         NewGzipCompressor(gzip.BestCompression),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	contents := []string{"jane@example.com\nlondon", "jane.doe@example.com\nlondon", "jane.doe@example.com\nparis"}
+	for _, content := range contents {
+		if err := plain.VersionCreate(ctx, NewVersion().SetEntityType("customer").SetEntityID("1").SetContent(content)); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	if err := plain.VersionCreate(ctx, NewVersion().SetEntityType("page").SetEntityID("1").SetContent("public")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	encryptor, err := NewAESGCMEncryptor(map[string][]byte{"key": bytes.Repeat([]byte("k"), 32)}, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_encryption_plaintext",
+		ContentCodec:         NewLineDeltaCodec(),
+		Compressor:           NewGzipCompressor(gzip.BestCompression),
+		Encryptor:            encryptor,
+		EncryptedEntityTypes: []string{"customer"},
+		ContentHashKey:       []byte("hash key"),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	encrypted, err := store.RotateKeys(ctx, "", "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if encrypted != 3 {
+		t.Fatal("Every plaintext customer version MUST be encrypted. Found:", encrypted)
+	}
+
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM version_encryption_plaintext WHERE entity_type = 'customer' AND content_key_id = ''`).Scan(&remaining); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if remaining != 0 {
+		t.Fatal("No customer version MUST remain in plaintext. Found:", remaining)
+	}
+
+	versions, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("customer").SetEntityID("1").SetOrderBy(COLUMN_VERSION_NUMBER).SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(versions) != len(contents) {
+		t.Fatal("Customer versions MUST be 3. Found:", len(versions))
+	}
+	for i, version := range versions {
+		if version.Content() != contents[i] {
+			t.Fatal("Encrypted version MUST be read decrypted. Found:", version.Content())
+		}
+		if version.ContentHash() != store.(*storeImplementation).versionContentHash("customer", contents[i]) {
+			t.Fatal("Content hash of an encrypted version MUST be keyed")
+		}
+	}
+
+	if page, err := plain.VersionLatest(ctx, "page", "1"); err != nil || page.Content() != "public" {
+		t.Fatal("Versions of entity types not encrypted MUST stay in plaintext")
+	}
+
+	again, err := store.RotateKeys(ctx, "", "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if again != 0 {
+		t.Fatal("Running again MUST encrypt nothing. Found:", again)
+	}
+}
+
+func TestStoreEncryptionOptions(t *testing.T) {
+	db := initDB(":memory:")
+
+	encryptor, err := NewAESGCMEncryptor(map[string][]byte{"key": bytes.Repeat([]byte("k"), 32)}, "key")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, opts := range []NewStoreOptions{
+		{DB: db, TableName: "version_encryption_options", Encryptor: encryptor, ContentHashKey: []byte("hash key")},
+		{DB: db, TableName: "version_encryption_options", EncryptedEntityTypes: []string{"customer"}},
+		{DB: db, TableName: "version_encryption_options", Encryptor: encryptor, EncryptedEntityTypes: []string{"customer"}, ContentHashKey: []byte("hash key"), BlobStorageEnabled: true},
+		{DB: db, TableName: "version_encryption_options", Encryptor: encryptor, EncryptedEntityTypes: []string{"customer"}},
+		{DB: db, TableName: "version_encryption_options", ContentHashKey: []byte("hash key")},
+	} {
+		if _, err := NewStore(opts); err == nil {
+			t.Fatal("Invalid encryption options MUST be rejected")
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	neatuid "github.com/dracory/neat/support/uid"
+	"github.com/dromara/carbon/v2"
+)
+
+// Column names for the tombstones and redactions tables
+const (
+	COLUMN_ERASED_AT     = "erased_at"
+	COLUMN_ERASED_BY     = "erased_by"
+	COLUMN_REDACTED_AT   = "redacted_at"
+	COLUMN_REDACTED_BY   = "redacted_by"
+	COLUMN_VERSION_COUNT = "version_count"
+	COLUMN_VERSION_ID    = "version_id"
+)
+
+// Tombstone records that the history of an entity was erased
+type Tombstone struct {
+	ID         string
+	EntityType string
+	EntityID   string
+
+	// VersionCount is the number of versions erased
+	VersionCount int64
+
+	// ErasedBy is the actor of the context the entity was erased with
+	ErasedBy string
+	ErasedAt time.Time
+}
+
+// Redaction records that the content of a version was redacted
+type Redaction struct {
+	ID         string
+	VersionID  string
+	EntityType string
+	EntityID   string
+
+	// RedactedBy is the actor of the context the version was redacted with
+	RedactedBy string
+	RedactedAt time.Time
+}
+
+// RedactFunc returns the redacted content of a version
+type RedactFunc func(version VersionInterface) (string, error)
+
+// tombstoneTableName returns the name of the tombstones table
+func (store *storeImplementation) tombstoneTableName() string {
+	return store.tableName + "_tombstone"
+}
+
+// redactionTableName returns the name of the redactions table
+func (store *storeImplementation) redactionTableName() string {
+	return store.tableName + "_redaction"
+}
+
+// erasureMigrateUp creates the tombstones and redactions tables
+func (store *storeImplementation) erasureMigrateUp(ctx context.Context) error {
+	tables := map[string]func(table contractsschema.Blueprint){
+		store.tombstoneTableName(): func(table contractsschema.Blueprint) {
+			table.String(COLUMN_ID, 21)
+			table.Primary(COLUMN_ID)
+			table.String(COLUMN_ENTITY_TYPE, 40)
+			table.String(COLUMN_ENTITY_ID, 40)
+			table.BigInteger(COLUMN_VERSION_COUNT).Default(0)
+			table.String(COLUMN_ERASED_BY, 100).Default("")
+			table.DateTime(COLUMN_ERASED_AT)
+			table.Index(COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID)
+		},
+		store.redactionTableName(): func(table contractsschema.Blueprint) {
+			table.String(COLUMN_ID, 21)
+			table.Primary(COLUMN_ID)
+			table.String(COLUMN_VERSION_ID, 21)
+			table.String(COLUMN_ENTITY_TYPE, 40)
+			table.String(COLUMN_ENTITY_ID, 40)
+			table.String(COLUMN_REDACTED_BY, 100).Default("")
+			table.DateTime(COLUMN_REDACTED_AT)
+			table.Index(COLUMN_VERSION_ID)
+			table.Index(COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID)
+		},
+	}
+
+	for _, tableName := range []string{store.tombstoneTableName(), store.redactionTableName()} {
+		hasTable, err := store.schemaHasTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if hasTable {
+			continue
+		}
+
+		if err := store.schemaCreate(ctx, tableName, tables[tableName]); err != nil {
+			if store.debugEnabled {
+				store.logger.Error("MigrateUp: creating erasure table failed", "table", tableName, "error", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// erasureMigrateDown drops the tombstones and redactions tables
+func (store *storeImplementation) erasureMigrateDown(ctx context.Context) error {
+	for _, tableName := range []string{store.tombstoneTableName(), store.redactionTableName()} {
+		hasTable, err := store.schemaHasTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if !hasTable {
+			continue
+		}
+
+		if err := store.schemaDrop(ctx, tableName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EraseEntity permanently deletes every version of an entity, soft deleted
+// ones included, along with the redactions and tags recorded for them, and records a
+// tombstone in their place. The tombstone keeps no content, only the
+// entity, the number of versions erased and the actor of the context. An
+// entity under legal hold cannot be erased.
+func (store *storeImplementation) EraseEntity(ctx context.Context, entityType string, entityID string) (*Tombstone, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+
+	tombstone := &Tombstone{
+		ID:         neatuid.GenerateShortID(),
+		EntityType: entityType,
+		EntityID:   entityID,
+		ErasedBy:   ActorFromContext(ctx),
+		ErasedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	err := store.transaction(ctx, func(txStore *storeImplementation) error {
+		if err := txStore.holdCheckEntity(ctx, entityType, entityID); err != nil {
+			return err
+		}
+
+		versions, err := txStore.queryVersions(ctx, `SELECT `+COLUMN_ID+` FROM `+txStore.tableName+
+			` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`, entityType, entityID)
+		if err != nil {
+			return err
+		}
+
+		chunkSize := batchChunkSize(nil, batchDeleteParameters)
+		for start := 0; start < len(versions); start += chunkSize {
+			ids := []string{}
+			for _, version := range versions[start:min(start+chunkSize, len(versions))] {
+				ids = append(ids, version.ID())
+			}
+
+			if err := txStore.versionDeleteBatch(ctx, ids, true); err != nil {
+				return err
+			}
+		}
+
+		tombstone.VersionCount = int64(len(versions))
+
+		for _, tableName := range []string{txStore.redactionTableName(), txStore.tagTableName()} {
+			if _, err := txStore.exec(ctx, `DELETE FROM `+tableName+
+				` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`, entityType, entityID); err != nil {
+				return err
+			}
+		}
+
+		_, err = txStore.exec(ctx, `INSERT INTO `+txStore.tombstoneTableName()+
+			` (`+COLUMN_ID+`, `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_VERSION_COUNT+`, `+COLUMN_ERASED_BY+`, `+COLUMN_ERASED_AT+`)`+
+			` VALUES (?, ?, ?, ?, ?, ?)`,
+			tombstone.ID, entityType, entityID, tombstone.VersionCount, tombstone.ErasedBy,
+			toDateTimeString(carbon.CreateFromStdTime(tombstone.ErasedAt)))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstone, nil
+}
+
+// TombstoneList returns the tombstones recorded for an entity, oldest first
+func (store *storeImplementation) TombstoneList(ctx context.Context, entityType string, entityID string) ([]Tombstone, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+
+	rows, err := store.query(ctx, `SELECT `+COLUMN_ID+`, `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_VERSION_COUNT+`, `+COLUMN_ERASED_BY+`, `+COLUMN_ERASED_AT+
+		` FROM `+store.tombstoneTableName()+
+		` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`+
+		` ORDER BY `+COLUMN_ERASED_AT+`, `+COLUMN_ID, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tombstones := []Tombstone{}
+	for rows.Next() {
+		var tombstone Tombstone
+		if err := rows.Scan(&tombstone.ID, &tombstone.EntityType, &tombstone.EntityID, &tombstone.VersionCount,
+			&tombstone.ErasedBy, &datetimeScanner{target: &tombstone.ErasedAt}); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+
+	return tombstones, rows.Err()
+}
+
+// RedactVersions rewrites in place the content of the versions matching
+// the query with the content returned by redact, recording for each
+// version whose content changed a redaction with the actor of the context.
+// The content hash of the redacted versions is updated. Nothing is redacted
+// if any of them is under legal hold. It returns the number of versions
+// redacted.
+func (store *storeImplementation) RedactVersions(ctx context.Context, query VersionQueryInterface, redact RedactFunc) (int64, error) {
+	if ctx == nil {
+		return 0, errors.New("ctx is nil")
+	}
+	if query == nil {
+		return 0, errors.New("version store: query is required")
+	}
+	if redact == nil {
+		return 0, errors.New("version store: redact func is required")
+	}
+
+	var redacted int64
+	err := store.transaction(ctx, func(txStore *storeImplementation) error {
+		versions, err := txStore.VersionList(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		changed := []VersionInterface{}
+		contents := []string{}
+		for _, version := range versions {
+			content, err := redact(version)
+			if err != nil {
+				return err
+			}
+			if content == version.Content() {
+				continue
+			}
+			changed = append(changed, version)
+			contents = append(contents, content)
+		}
+
+		if len(changed) == 0 {
+			return nil
+		}
+
+		ids := []string{}
+		for _, version := range changed {
+			ids = append(ids, version.ID())
+		}
+
+		if err := txStore.holdCheckVersions(ctx, ids); err != nil {
+			return err
+		}
+
+		// versions encoded against the redacted ones are stored whole first,
+		// as they cannot be decoded once their base changes
+		if store.contentCodec != nil {
+			if err := txStore.contentDetach(ctx, ids); err != nil {
+				return err
+			}
+		}
+
+		redactedAt := toDateTimeString(carbon.Now(carbon.UTC))
+		redactedBy := ActorFromContext(ctx)
+
+		for i, version := range changed {
+			if err := txStore.versionRewriteContent(ctx, version, contents[i]); err != nil {
+				return err
+			}
+
+			_, err := txStore.exec(ctx, `INSERT INTO `+txStore.redactionTableName()+
+				` (`+COLUMN_ID+`, `+COLUMN_VERSION_ID+`, `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_REDACTED_BY+`, `+COLUMN_REDACTED_AT+`)`+
+				` VALUES (?, ?, ?, ?, ?, ?)`,
+				neatuid.GenerateShortID(), version.ID(), version.EntityType(), version.EntityID(), redactedBy, redactedAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		redacted = int64(len(changed))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return redacted, nil
+}
+
+// VersionRedactions returns the redactions recorded for a version, oldest
+// first
+func (store *storeImplementation) VersionRedactions(ctx context.Context, versionID string) ([]Redaction, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+
+	rows, err := store.query(ctx, `SELECT `+COLUMN_ID+`, `+COLUMN_VERSION_ID+`, `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_REDACTED_BY+`, `+COLUMN_REDACTED_AT+
+		` FROM `+store.redactionTableName()+
+		` WHERE `+COLUMN_VERSION_ID+` = ?`+
+		` ORDER BY `+COLUMN_REDACTED_AT+`, `+COLUMN_ID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redactions := []Redaction{}
+	for rows.Next() {
+		var redaction Redaction
+		if err := rows.Scan(&redaction.ID, &redaction.VersionID, &redaction.EntityType, &redaction.EntityID,
+			&redaction.RedactedBy, &datetimeScanner{target: &redaction.RedactedAt}); err != nil {
+			return nil, err
+		}
+		redactions = append(redactions, redaction)
+	}
+
+	return redactions, rows.Err()
+}
+
+// versionRewriteContent replaces the stored content of a version, and its
+// content hash, storing it whole
+func (store *storeImplementation) versionRewriteContent(ctx context.Context, version VersionInterface, content string) error {
+	hash := store.versionContentHash(version.EntityType(), content)
+
+	if store.blobTableName != "" {
+		if err := store.blobRelease(ctx, []string{version.ID()}); err != nil {
+			return err
+		}
+		if err := store.blobAcquire(ctx, hash, content); err != nil {
+			return err
+		}
+
+		_, err := store.exec(ctx, `UPDATE `+store.tableName+
+			` SET `+COLUMN_CONTENT+` = '', `+COLUMN_CONTENT_HASH+` = ?`+
+			` WHERE `+COLUMN_ID+` = ?`, hash, version.ID())
+		if err != nil {
+			return err
+		}
+
+		return store.blobCollect(ctx)
+	}
+
+	if err := store.contentUpdate(ctx, versionOwner(version), storedContent{content: content}); err != nil {
+		return err
+	}
+
+	_, err := store.exec(ctx, `UPDATE `+store.tableName+
+		` SET `+COLUMN_CONTENT_HASH+` = ?`+
+		` WHERE `+COLUMN_ID+` = ?`, hash, version.ID())
+	return err
+}
@@ -0,0 +1,195 @@
+package versionstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStoreEraseEntity(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_erase",
+		AutomigrateEnabled: true,
+		BlobStorageEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	versions := []VersionInterface{
+		NewVersion().SetEntityType("customer").SetEntityID("1").SetContent("jane"),
+		NewVersion().SetEntityType("customer").SetEntityID("1").SetContent("jane doe"),
+		NewVersion().SetEntityType("customer").SetEntityID("1").SetContent("shared"),
+		NewVersion().SetEntityType("customer").SetEntityID("2").SetContent("shared"),
+	}
+	for _, version := range versions {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if err := store.VersionSoftDeleteByID(ctx, versions[0].ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	tombstone, err := store.EraseEntity(WithActor(ctx, "dpo"), "customer", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if tombstone.VersionCount != 3 || tombstone.ErasedBy != "dpo" || tombstone.EntityID != "1" {
+		t.Fatal("Tombstone MUST record the erased versions and the actor. Found:", tombstone)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM version_erase WHERE entity_id = '1'`).Scan(&count); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if count != 0 {
+		t.Fatal("Every version of the entity, soft deleted ones included, MUST be deleted. Found:", count)
+	}
+
+	counts := blobRefCounts(t, db, "version_erase_blob")
+	if len(counts) != 1 || counts[contentHash("shared")] != 1 {
+		t.Fatal("Only the blob still referenced MUST be kept. Found:", counts)
+	}
+
+	other, err := store.VersionLatest(ctx, "customer", "2")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if other == nil || other.Content() != "shared" {
+		t.Fatal("Other entities MUST NOT be erased")
+	}
+
+	tombstones, err := store.TombstoneList(ctx, "customer", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(tombstones) != 1 || tombstones[0].ID != tombstone.ID || tombstones[0].ErasedAt.IsZero() {
+		t.Fatal("Tombstone MUST be listed. Found:", tombstones)
+	}
+
+	if _, err := store.EraseEntity(ctx, "customer", ""); err == nil {
+		t.Fatal("Erasing without an entity id MUST fail")
+	}
+}
+
+func TestStoreRedactVersions(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_redact",
+		AutomigrateEnabled: true,
+		ContentCodec:       NewLineDeltaCodec(),
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	contents := []string{
+		"name: Jane\nemail: jane@example.com",
+		"name: Jane\nemail: jane@example.com\nphone: none",
+		"name: Jane\nphone: none",
+	}
+	versions := []VersionInterface{}
+	for _, content := range contents {
+		version := NewVersion().SetEntityType("customer").SetEntityID("1").SetContent(content)
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		versions = append(versions, version)
+	}
+
+	redact := func(version VersionInterface) (string, error) {
+		return strings.ReplaceAll(version.Content(), "jane@example.com", "[redacted]"), nil
+	}
+
+	redacted, err := store.RedactVersions(WithActor(ctx, "dpo"), NewVersionQuery().
+		SetEntityType("customer").
+		SetEntityID("1"), redact)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if redacted != 2 {
+		t.Fatal("Only the versions whose content changed MUST be redacted. Found:", redacted)
+	}
+
+	var leaks int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM version_redact WHERE content LIKE '%example.com%'`).Scan(&leaks); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if leaks != 0 {
+		t.Fatal("Redacted content MUST NOT be stored anymore. Found:", leaks)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("customer").
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expected := []string{
+		"name: Jane\nemail: [redacted]",
+		"name: Jane\nemail: [redacted]\nphone: none",
+		"name: Jane\nphone: none",
+	}
+	for i, version := range list {
+		if version.Content() != expected[i] {
+			t.Fatalf("Version %d MUST have content %q, found %q", i+1, expected[i], version.Content())
+		}
+		if version.ContentHash() != contentHash(expected[i]) {
+			t.Fatalf("Version %d MUST have the hash of its redacted content", i+1)
+		}
+	}
+
+	redactions, err := store.VersionRedactions(ctx, versions[0].ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(redactions) != 1 || redactions[0].RedactedBy != "dpo" || redactions[0].EntityID != "1" {
+		t.Fatal("Redaction MUST be recorded with the actor. Found:", redactions)
+	}
+
+	redactions, err = store.VersionRedactions(ctx, versions[2].ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(redactions) != 0 {
+		t.Fatal("Unchanged version MUST NOT record a redaction. Found:", redactions)
+	}
+
+	if _, err := store.EraseEntity(ctx, "customer", "1"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	redactions, err = store.VersionRedactions(ctx, versions[0].ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(redactions) != 0 {
+		t.Fatal("Erasing an entity MUST delete its redactions. Found:", redactions)
+	}
+}
+
+func TestActorFromContext(t *testing.T) {
+	if actor := ActorFromContext(context.Background()); actor != "" {
+		t.Fatal("Context without an actor MUST have an empty actor. Found:", actor)
+	}
+
+	if actor := ActorFromContext(WithActor(context.Background(), "jane")); actor != "jane" {
+		t.Fatal("Actor MUST be jane. Found:", actor)
+	}
+}
@@ -0,0 +1,269 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	neatuid "github.com/dracory/neat/support/uid"
+	"github.com/dromara/carbon/v2"
+)
+
+// Column names for the holds table
+const (
+	COLUMN_HOLD_REASON = "reason"
+	COLUMN_PLACED_AT   = "placed_at"
+	COLUMN_PLACED_BY   = "placed_by"
+)
+
+// Hold freezes the history of an entity: while an entity has a hold its
+// versions cannot be deleted, soft deleted, scheduled to expire, pruned,
+// purged, redacted or erased. An entity can have several holds, one per legal matter.
+type Hold struct {
+	ID         string
+	EntityType string
+	EntityID   string
+	Reason     string
+
+	// PlacedBy is the actor of the context the hold was placed with
+	PlacedBy string
+	PlacedAt time.Time
+}
+
+// LegalHoldError is returned when an operation would alter the history of
+// entities under legal hold
+type LegalHoldError struct {
+	// Holds are the holds on the entities the operation left untouched
+	Holds []Hold
+}
+
+func (e *LegalHoldError) Error() string {
+	if len(e.Holds) == 0 {
+		return ErrUnderLegalHold.Error()
+	}
+
+	msg := ErrUnderLegalHold.Error() + ": " + e.Holds[0].EntityType + "/" + e.Holds[0].EntityID
+	if len(e.Holds) > 1 {
+		msg += " and " + strconv.Itoa(len(e.Holds)-1) + " more"
+	}
+
+	return msg
+}
+
+// Is makes errors.Is(err, ErrUnderLegalHold) true for legal hold errors
+func (e *LegalHoldError) Is(target error) bool {
+	return target == ErrUnderLegalHold
+}
+
+// holdTableName returns the name of the holds table
+func (store *storeImplementation) holdTableName() string {
+	return store.tableName + "_hold"
+}
+
+// holdMigrateUp creates the holds table
+func (store *storeImplementation) holdMigrateUp(ctx context.Context) error {
+	hasTable, err := store.schemaHasTable(ctx, store.holdTableName())
+	if err != nil {
+		return err
+	}
+	if hasTable {
+		return nil
+	}
+
+	err = store.schemaCreate(ctx, store.holdTableName(), func(table contractsschema.Blueprint) {
+		table.String(COLUMN_ID, 21)
+		table.Primary(COLUMN_ID)
+		table.String(COLUMN_ENTITY_TYPE, 40)
+		table.String(COLUMN_ENTITY_ID, 40)
+		table.Text(COLUMN_HOLD_REASON)
+		table.String(COLUMN_PLACED_BY, 100).Default("")
+		table.DateTime(COLUMN_PLACED_AT)
+		table.Index(COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID)
+	})
+
+	if err != nil && store.debugEnabled {
+		store.logger.Error("MigrateUp: creating hold table failed", "error", err)
+	}
+
+	return err
+}
+
+// holdMigrateDown drops the holds table
+func (store *storeImplementation) holdMigrateDown(ctx context.Context) error {
+	hasTable, err := store.schemaHasTable(ctx, store.holdTableName())
+	if err != nil {
+		return err
+	}
+	if !hasTable {
+		return nil
+	}
+
+	return store.schemaDrop(ctx, store.holdTableName())
+}
+
+// PlaceHold places a legal hold on an entity, recording the reason and the
+// actor of the context. The expiries scheduled on the entity's versions are
+// cancelled, and are not rescheduled when the hold is released.
+func (store *storeImplementation) PlaceHold(ctx context.Context, entityType string, entityID string, reason string) (*Hold, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+	if reason == "" {
+		return nil, errors.New("version store: hold reason is required")
+	}
+
+	hold := &Hold{
+		ID:         neatuid.GenerateShortID(),
+		EntityType: entityType,
+		EntityID:   entityID,
+		Reason:     reason,
+		PlacedBy:   ActorFromContext(ctx),
+		PlacedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	err := store.transaction(ctx, func(txStore *storeImplementation) error {
+		_, err := txStore.exec(ctx, `INSERT INTO `+txStore.holdTableName()+
+			` (`+COLUMN_ID+`, `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_HOLD_REASON+`, `+COLUMN_PLACED_BY+`, `+COLUMN_PLACED_AT+`)`+
+			` VALUES (?, ?, ?, ?, ?, ?)`,
+			hold.ID, hold.EntityType, hold.EntityID, hold.Reason, hold.PlacedBy,
+			toDateTimeString(carbon.CreateFromStdTime(hold.PlacedAt)))
+		if err != nil {
+			return err
+		}
+
+		// a scheduled expiry would soft delete the version once due, so
+		// the pending ones are cancelled
+		_, err = txStore.exec(ctx, `UPDATE `+txStore.tableName+
+			` SET `+COLUMN_SOFT_DELETED_AT+` = ?`+
+			` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`+
+			` AND `+COLUMN_SOFT_DELETED_AT+` > ? AND `+COLUMN_SOFT_DELETED_AT+` < ?`,
+			MAX_DATETIME, entityType, entityID, toDateTimeString(carbon.Now(carbon.UTC)), MAX_DATETIME)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// ReleaseHold releases a legal hold. The entity stays frozen while it has
+// other holds.
+func (store *storeImplementation) ReleaseHold(ctx context.Context, holdID string) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+	if holdID == "" {
+		return errors.New("version store: hold id is required")
+	}
+
+	result, err := store.exec(ctx, `DELETE FROM `+store.holdTableName()+` WHERE `+COLUMN_ID+` = ?`, holdID)
+	if err != nil {
+		return err
+	}
+
+	released, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return errors.New("version store: hold not found")
+	}
+
+	return nil
+}
+
+// HoldList returns the legal holds on an entity, oldest first
+func (store *storeImplementation) HoldList(ctx context.Context, entityType string, entityID string) ([]Hold, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+
+	return store.queryHolds(ctx, ` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`, entityType, entityID)
+}
+
+// holdCheckEntity returns a *LegalHoldError if the entity is under legal
+// hold
+func (store *storeImplementation) holdCheckEntity(ctx context.Context, entityType string, entityID string) error {
+	holds, err := store.HoldList(ctx, entityType, entityID)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return &LegalHoldError{Holds: holds}
+	}
+
+	return nil
+}
+
+// holdCheckVersions returns a *LegalHoldError if any of the versions with
+// the given ids belongs to an entity under legal hold
+func (store *storeImplementation) holdCheckVersions(ctx context.Context, ids []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	args := []any{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	holds, err := store.queryHolds(ctx, ` WHERE EXISTS (SELECT 1 FROM `+store.tableName+
+		` WHERE `+store.tableName+`.`+COLUMN_ID+` IN (`+placeholders+`)`+
+		` AND `+store.tableName+`.`+COLUMN_ENTITY_TYPE+` = `+store.holdTableName()+`.`+COLUMN_ENTITY_TYPE+
+		` AND `+store.tableName+`.`+COLUMN_ENTITY_ID+` = `+store.holdTableName()+`.`+COLUMN_ENTITY_ID+`)`, args...)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return &LegalHoldError{Holds: holds}
+	}
+
+	return nil
+}
+
+// holdEntityNotExistsSQL returns a condition, binding an entity type and
+// id, that is true for entities without legal hold
+func (store *storeImplementation) holdEntityNotExistsSQL() string {
+	return `NOT EXISTS (SELECT 1 FROM ` + store.holdTableName() +
+		` WHERE ` + COLUMN_ENTITY_TYPE + ` = ? AND ` + COLUMN_ENTITY_ID + ` = ?)`
+}
+
+// holdNotExistsSQL returns a condition on the version table that is true
+// for versions of entities without legal hold
+func (store *storeImplementation) holdNotExistsSQL() string {
+	return `NOT EXISTS (SELECT 1 FROM ` + store.holdTableName() +
+		` WHERE ` + store.holdTableName() + `.` + COLUMN_ENTITY_TYPE + ` = ` + store.tableName + `.` + COLUMN_ENTITY_TYPE +
+		` AND ` + store.holdTableName() + `.` + COLUMN_ENTITY_ID + ` = ` + store.tableName + `.` + COLUMN_ENTITY_ID + `)`
+}
+
+// queryHolds returns the holds matching the given where clause, oldest
+// first
+func (store *storeImplementation) queryHolds(ctx context.Context, where string, args ...any) ([]Hold, error) {
+	rows, err := store.query(ctx, `SELECT `+COLUMN_ID+`, `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_HOLD_REASON+`, `+COLUMN_PLACED_BY+`, `+COLUMN_PLACED_AT+
+		` FROM `+store.holdTableName()+where+
+		` ORDER BY `+COLUMN_PLACED_AT+`, `+COLUMN_ID, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []Hold{}
+	for rows.Next() {
+		var hold Hold
+		if err := rows.Scan(&hold.ID, &hold.EntityType, &hold.EntityID, &hold.Reason,
+			&hold.PlacedBy, &datetimeScanner{target: &hold.PlacedAt}); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+
+	return holds, rows.Err()
+}
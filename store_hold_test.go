@@ -0,0 +1,230 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreLegalHold(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_hold",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	held := NewVersion().SetEntityType("contract").SetEntityID("1").SetContent("signed")
+	free := NewVersion().SetEntityType("contract").SetEntityID("2").SetContent("draft")
+	for _, version := range []VersionInterface{held, free} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	hold, err := store.PlaceHold(WithActor(ctx, "legal"), "contract", "1", "litigation 42")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if hold.PlacedBy != "legal" || hold.Reason != "litigation 42" {
+		t.Fatal("Hold MUST record its reason and actor. Found:", hold)
+	}
+
+	checks := map[string]error{
+		"VersionDelete":         store.VersionDelete(ctx, held),
+		"VersionDeleteByID":     store.VersionDeleteByID(ctx, held.ID()),
+		"VersionSoftDelete":     store.VersionSoftDelete(ctx, held),
+		"VersionSoftDeleteByID": store.VersionSoftDeleteByID(ctx, held.ID()),
+		"VersionExpireAt":       store.VersionExpireAt(ctx, held.ID(), time.Now().Add(time.Hour)),
+		"VersionUpdate":         store.VersionUpdate(ctx, NewVersion().SetID(held.ID()).SetSoftDeletedAt(time.Now().UTC().Format(time.DateTime))),
+	}
+
+	checks["VersionCreate"] = store.VersionCreate(ctx, NewVersion().SetEntityType("contract").SetEntityID("1").SetContent("expiring").SetExpiresAt(time.Now().Add(time.Hour)))
+	checks["VersionCreateMany"] = store.VersionCreateMany(ctx, []VersionInterface{
+		NewVersion().SetEntityType("contract").SetEntityID("1").SetContent("expiring").SetExpiresAt(time.Now().Add(time.Hour)),
+	})
+	_, checks["VersionRestore"] = store.VersionRestore(ctx, held.ID(), VersionRestoreOptions{SoftDeleteIntermediate: true})
+	_, checks["EraseEntity"] = store.EraseEntity(ctx, "contract", "1")
+	_, checks["RedactVersions"] = store.RedactVersions(ctx, NewVersionQuery().SetEntityID("1"), func(version VersionInterface) (string, error) {
+		return strings.ToUpper(version.Content()), nil
+	})
+
+	for operation, err := range checks {
+		if !errors.Is(err, ErrUnderLegalHold) {
+			t.Fatalf("%s MUST fail with ErrUnderLegalHold. Found: %v", operation, err)
+		}
+	}
+
+	for operation, err := range map[string]error{
+		"VersionDeleteMany":     store.VersionDeleteMany(ctx, []string{free.ID(), held.ID()}),
+		"VersionSoftDeleteMany": store.VersionSoftDeleteMany(ctx, []string{free.ID(), held.ID()}),
+	} {
+		if !errors.Is(err, ErrUnderLegalHold) {
+			t.Fatalf("%s MUST fail with ErrUnderLegalHold. Found: %v", operation, err)
+		}
+	}
+
+	if found, err := store.VersionFindByID(ctx, free.ID()); err != nil || found == nil || found.IsSoftDeleted() {
+		t.Fatal("Versions deleted along with held ones MUST be left untouched")
+	}
+
+	var holdErr *LegalHoldError
+	if err := store.VersionDeleteByID(ctx, held.ID()); !errors.As(err, &holdErr) || len(holdErr.Holds) != 1 || holdErr.Holds[0].ID != hold.ID {
+		t.Fatal("Error MUST list the holds. Found:", err)
+	}
+
+	found, err := store.VersionFindByID(ctx, held.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.Content() != "signed" || found.IsSoftDeleted() {
+		t.Fatal("Held version MUST be left untouched")
+	}
+
+	if err := store.VersionDeleteByID(ctx, free.ID()); err != nil {
+		t.Fatal("Entities without hold MUST be deletable. Found:", err)
+	}
+
+	holds, err := store.HoldList(ctx, "contract", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(holds) != 1 {
+		t.Fatal("Hold MUST be listed. Found:", holds)
+	}
+
+	if err := store.ReleaseHold(ctx, hold.ID); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.ReleaseHold(ctx, hold.ID); err == nil {
+		t.Fatal("Releasing a released hold MUST fail")
+	}
+
+	if err := store.VersionDeleteByID(ctx, held.ID()); err != nil {
+		t.Fatal("Released entity MUST be deletable. Found:", err)
+	}
+}
+
+func TestStoreLegalHoldCancelsExpiry(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_hold_expiry",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	expiring := NewVersion().SetEntityType("contract").SetEntityID("1").SetContent("signed").SetExpiresAt(time.Now().Add(time.Hour))
+	other := NewVersion().SetEntityType("contract").SetEntityID("2").SetContent("draft").SetExpiresAt(time.Now().Add(time.Hour))
+	for _, version := range []VersionInterface{expiring, other} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	hold, err := store.PlaceHold(ctx, "contract", "1", "litigation 42")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.ReleaseHold(ctx, hold.ID); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.VersionFindByID(ctx, expiring.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || !found.ExpiresAt().IsZero() {
+		t.Fatal("Hold MUST cancel the expiry of the held versions. Found:", found)
+	}
+
+	found, err = store.VersionFindByID(ctx, other.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.ExpiresAt().IsZero() {
+		t.Fatal("Hold MUST NOT cancel the expiry of other entities. Found:", found)
+	}
+}
+
+func TestStoreLegalHoldPruneAndPurge(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_hold_prune",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for _, entityID := range []string{"1", "2"} {
+		for i := range 3 {
+			version := NewVersion().SetEntityType("contract").SetEntityID(entityID).SetContent("v" + strconv.Itoa(i))
+			if err := store.VersionCreate(ctx, version); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+		}
+	}
+
+	if _, err := store.PlaceHold(ctx, "contract", "1", "audit"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	report, err := store.Prune(ctx, RetentionPolicy{RetentionRules: RetentionRules{KeepLast: 1}}, false)
+	if !errors.Is(err, ErrUnderLegalHold) {
+		t.Fatal("Prune MUST report the held entity. Found:", err)
+	}
+	if report == nil || len(report.Removed) != 2 {
+		t.Fatal("Prune MUST prune the entities without hold")
+	}
+	for _, version := range report.Removed {
+		if version.EntityID() != "2" {
+			t.Fatal("Prune MUST NOT remove versions of held entities")
+		}
+	}
+
+	for _, entityID := range []string{"1", "2"} {
+		if _, err := db.Exec(`UPDATE version_hold_prune SET soft_deleted_at = '2000-01-01 00:00:00' WHERE entity_id = ?`, entityID); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	purged, err := store.PurgeSoftDeleted(ctx, 0, 0)
+	if !errors.Is(err, ErrUnderLegalHold) {
+		t.Fatal("PurgeSoftDeleted MUST report the held entity. Found:", err)
+	}
+	if purged["contract"] != 3 {
+		t.Fatal("PurgeSoftDeleted MUST purge the entities without hold. Found:", purged)
+	}
+
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM version_hold_prune WHERE entity_id = '1'`).Scan(&remaining); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if remaining != 3 {
+		t.Fatal("Held versions MUST be kept. Found:", remaining)
+	}
+}
@@ -2,9 +2,14 @@ package versionstore
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/dracory/neat"
@@ -22,6 +27,44 @@ type NewStoreOptions struct {
 	AutomigrateEnabled bool
 	DebugEnabled       bool
 	Logger             *slog.Logger
+
+	// SkipUnchangedContent makes VersionCreate skip versions whose content
+	// is identical to the head of their branch, filling the given version
+	// with the existing head instead of creating a new one
+	SkipUnchangedContent bool
+
+	// BlobStorageEnabled stores each distinct content once, in a blobs table
+	// keyed by content hash, instead of in every version row
+	BlobStorageEnabled bool
+
+	// BlobTableName is the name of the blobs table, defaults to the table
+	// name followed by "_blob"
+	BlobTableName string
+
+	// ContentCodec, when set, stores the content of versions as deltas
+	// against their parent. It cannot be combined with blob storage.
+	ContentCodec ContentCodec
+
+	// KeyframeInterval is the number of versions between two full content
+	// snapshots, defaults to DEFAULT_KEYFRAME_INTERVAL
+	KeyframeInterval int
+
+	// Compressor, when set, compresses the content of new versions. Rows
+	// written without it, or with gzip, stay readable. It cannot be combined
+	// with blob storage.
+	Compressor Compressor
+
+	// Encryptor, when set, encrypts the content of the versions of the
+	// EncryptedEntityTypes. It cannot be combined with blob storage.
+	Encryptor            Encryptor
+	EncryptedEntityTypes []string
+
+	// ContentHashKey is the key the content hashes of the versions of the
+	// EncryptedEntityTypes are computed with, as HMAC-SHA256, so that they
+	// do not reveal their content. It is required with an encryptor, and
+	// kept apart from the encryption keys so that rotating those leaves the
+	// hashes unchanged.
+	ContentHashKey []byte
 }
 
 // NewStore creates a new version store
@@ -34,6 +77,38 @@ func NewStore(opts NewStoreOptions) (StoreInterface, error) {
 		return nil, errors.New("version store: tableName is required")
 	}
 
+	if opts.ContentCodec != nil && opts.BlobStorageEnabled {
+		return nil, errors.New("version store: content codec and blob storage cannot be combined")
+	}
+
+	if opts.Compressor != nil && opts.BlobStorageEnabled {
+		return nil, errors.New("version store: compression and blob storage cannot be combined")
+	}
+
+	if opts.Encryptor != nil && opts.BlobStorageEnabled {
+		return nil, errors.New("version store: encryption and blob storage cannot be combined")
+	}
+
+	if opts.Encryptor != nil && len(opts.EncryptedEntityTypes) == 0 {
+		return nil, errors.New("version store: encrypted entity types are required with an encryptor")
+	}
+
+	if opts.Encryptor == nil && len(opts.EncryptedEntityTypes) > 0 {
+		return nil, errors.New("version store: encrypted entity types require an encryptor")
+	}
+
+	if opts.Encryptor != nil && len(opts.ContentHashKey) == 0 {
+		return nil, errors.New("version store: content hash key is required with an encryptor")
+	}
+
+	if opts.Encryptor == nil && len(opts.ContentHashKey) > 0 {
+		return nil, errors.New("version store: content hash key requires an encryptor")
+	}
+
+	if opts.KeyframeInterval < 0 {
+		return nil, errors.New("version store: keyframe interval cannot be negative")
+	}
+
 	neatDB, err := neat.NewFromSQLDB(opts.DB)
 	if err != nil {
 		return nil, err
@@ -47,9 +122,33 @@ func NewStore(opts NewStoreOptions) (StoreInterface, error) {
 	store := &storeImplementation{
 		tableName:          opts.TableName,
 		db:                 neatDB,
+		sqlDB:              opts.DB,
 		automigrateEnabled: opts.AutomigrateEnabled,
 		debugEnabled:       opts.DebugEnabled,
 		logger:             logger,
+
+		skipUnchangedContent: opts.SkipUnchangedContent,
+		contentCodec:         opts.ContentCodec,
+		keyframeInterval:     opts.KeyframeInterval,
+		compressor:           opts.Compressor,
+		encryptor:            opts.Encryptor,
+		encryptedEntityTypes: map[string]bool{},
+		contentHashKey:       opts.ContentHashKey,
+	}
+
+	for _, entityType := range opts.EncryptedEntityTypes {
+		store.encryptedEntityTypes[entityType] = true
+	}
+
+	if store.keyframeInterval == 0 {
+		store.keyframeInterval = DEFAULT_KEYFRAME_INTERVAL
+	}
+
+	if opts.BlobStorageEnabled {
+		store.blobTableName = opts.BlobTableName
+		if store.blobTableName == "" {
+			store.blobTableName = opts.TableName + "_blob"
+		}
 	}
 
 	if store.automigrateEnabled {
@@ -67,9 +166,26 @@ func NewStore(opts NewStoreOptions) (StoreInterface, error) {
 type storeImplementation struct {
 	tableName          string
 	db                 *neat.Database
+	sqlDB              *sql.DB
+	tx                 *sql.Tx
 	logger             *slog.Logger
 	automigrateEnabled bool
 	debugEnabled       bool
+
+	skipUnchangedContent bool
+
+	// blobTableName is the name of the blobs table, empty when blob storage
+	// is disabled
+	blobTableName string
+
+	contentCodec     ContentCodec
+	keyframeInterval int
+
+	compressor Compressor
+
+	encryptor            Encryptor
+	encryptedEntityTypes map[string]bool
+	contentHashKey       []byte
 }
 
 var _ StoreInterface = (*storeImplementation)(nil)
@@ -81,21 +197,38 @@ func (store *storeImplementation) AutoMigrate() error {
 
 // MigrateUp creates the table
 func (store *storeImplementation) MigrateUp(ctx context.Context, tx ...*sql.Tx) error {
-	if store.db.Schema().HasTable(store.tableName) {
+	if len(tx) > 0 && tx[0] != nil {
+		return store.WithTx(tx[0]).MigrateUp(ctx)
+	}
+
+	hasTable, err := store.schemaHasTable(ctx, store.tableName)
+	if err != nil {
+		return err
+	}
+
+	if hasTable {
 		if store.debugEnabled {
 			store.logger.Info("MigrateUp: table already exists", "table", store.tableName)
 		}
-		return nil
+		if err := store.migrateColumns(ctx); err != nil {
+			return err
+		}
+		return store.sideTablesMigrateUp(ctx)
 	}
 
-	err := store.db.Schema().Create(store.tableName, func(table contractsschema.Blueprint) {
+	err = store.schemaCreate(ctx, store.tableName, func(table contractsschema.Blueprint) {
 		table.String(COLUMN_ID, 21)
 		table.Primary(COLUMN_ID)
 		table.String(COLUMN_ENTITY_TYPE, 40)
 		table.String(COLUMN_ENTITY_ID, 40)
+		table.BigInteger(COLUMN_VERSION_NUMBER).Default(0)
 		table.Text(COLUMN_CONTENT)
 		table.DateTime(COLUMN_CREATED_AT)
 		table.DateTime(COLUMN_SOFT_DELETED_AT)
+
+		for _, migration := range columnMigrations() {
+			migration.define(table)
+		}
 	})
 
 	if err != nil {
@@ -105,19 +238,273 @@ func (store *storeImplementation) MigrateUp(ctx context.Context, tx ...*sql.Tx)
 		return err
 	}
 
+	if err := store.createVersionNumberIndex(ctx); err != nil {
+		return err
+	}
+
+	return store.sideTablesMigrateUp(ctx)
+}
+
+// sideTablesMigrateUp creates the tables kept next to the version table
+func (store *storeImplementation) sideTablesMigrateUp(ctx context.Context) error {
+	if err := store.blobMigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.erasureMigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.holdMigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.tagMigrateUp(ctx); err != nil {
+		return err
+	}
+
+	return store.changesetMigrateUp(ctx)
+}
+
+// columnMigration defines a column added to the version table after its
+// first release, with an optional backfill filling it for existing versions
+type columnMigration struct {
+	column   string
+	define   func(table contractsschema.Blueprint)
+	backfill func(store *storeImplementation, ctx context.Context) error
+}
+
+// columnMigrations returns the columns added after the first release, in the
+// order they were introduced
+func columnMigrations() []columnMigration {
+	return []columnMigration{
+		{COLUMN_PARENT_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_PARENT_ID, 21).Default("")
+		}, nil},
+		{COLUMN_BRANCH, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_BRANCH, 100).Default(DEFAULT_BRANCH)
+		}, nil},
+		{COLUMN_MERGE_PARENT_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_MERGE_PARENT_ID, 21).Default("")
+		}, nil},
+		{COLUMN_RESTORED_FROM, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_RESTORED_FROM, 21).Default("")
+		}, nil},
+		{COLUMN_CONTENT_HASH, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CONTENT_HASH, 64).Default("")
+			table.Index(COLUMN_CONTENT_HASH)
+		}, (*storeImplementation).migrateContentHash},
+		{COLUMN_CONTENT_CODEC, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CONTENT_CODEC, 40).Default("")
+		}, nil},
+		{COLUMN_DELTA_BASE_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_DELTA_BASE_ID, 21).Default("")
+			table.Index(COLUMN_DELTA_BASE_ID)
+		}, nil},
+		{COLUMN_DELTA_DEPTH, func(table contractsschema.Blueprint) {
+			table.BigInteger(COLUMN_DELTA_DEPTH).Default(0)
+		}, nil},
+		{COLUMN_CONTENT_COMPRESSION, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CONTENT_COMPRESSION, 40).Default("")
+		}, nil},
+		{COLUMN_CONTENT_KEY_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CONTENT_KEY_ID, 100).Default("")
+			table.Index(COLUMN_CONTENT_KEY_ID)
+		}, nil},
+		{COLUMN_AUTHOR_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_AUTHOR_ID, 100).Default("")
+			table.Index(COLUMN_AUTHOR_ID)
+		}, nil},
+		{COLUMN_MESSAGE, func(table contractsschema.Blueprint) {
+			table.Text(COLUMN_MESSAGE).Nullable()
+		}, nil},
+		{COLUMN_METADATA, func(table contractsschema.Blueprint) {
+			table.Text(COLUMN_METADATA).Nullable()
+		}, nil},
+		{COLUMN_CHANGESET_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CHANGESET_ID, 21).Default("")
+			table.Index(COLUMN_CHANGESET_ID)
+		}, nil},
+	}
+}
+
+// migrateColumns brings a table created by an earlier release up to date
+// by adding the columns it is missing
+func (store *storeImplementation) migrateColumns(ctx context.Context) error {
+	if err := store.migrateVersionNumber(ctx); err != nil {
+		return err
+	}
+
+	for _, migration := range columnMigrations() {
+		hasColumn, err := store.schemaHasColumn(ctx, store.tableName, migration.column)
+		if err != nil {
+			return err
+		}
+		if hasColumn {
+			continue
+		}
+
+		if err := store.schemaTable(ctx, store.tableName, migration.define); err != nil {
+			if store.debugEnabled {
+				store.logger.Error("MigrateUp: adding column failed", "column", migration.column, "error", err)
+			}
+			return err
+		}
+
+		if migration.backfill == nil {
+			continue
+		}
+
+		if err := migration.backfill(store, ctx); err != nil {
+			if store.debugEnabled {
+				store.logger.Error("MigrateUp: filling column failed", "column", migration.column, "error", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateVersionNumber adds the version_number column to a table created
+// before version numbers existed, numbering the existing versions of each
+// entity by creation time.
+func (store *storeImplementation) migrateVersionNumber(ctx context.Context) error {
+	hasColumn, err := store.schemaHasColumn(ctx, store.tableName, COLUMN_VERSION_NUMBER)
+	if err != nil {
+		return err
+	}
+	if hasColumn {
+		return nil
+	}
+
+	err = store.schemaTable(ctx, store.tableName, func(table contractsschema.Blueprint) {
+		table.BigInteger(COLUMN_VERSION_NUMBER).Default(0)
+	})
+	if err != nil {
+		if store.debugEnabled {
+			store.logger.Error("MigrateUp: adding version number failed", "error", err)
+		}
+		return err
+	}
+
+	sqlStr := `UPDATE ` + store.tableName + ` SET ` + COLUMN_VERSION_NUMBER + ` = (` +
+		`SELECT COUNT(*) FROM ` + store.tableName + ` AS previous` +
+		` WHERE previous.` + COLUMN_ENTITY_TYPE + ` = ` + store.tableName + `.` + COLUMN_ENTITY_TYPE +
+		` AND previous.` + COLUMN_ENTITY_ID + ` = ` + store.tableName + `.` + COLUMN_ENTITY_ID +
+		` AND (previous.` + COLUMN_CREATED_AT + ` < ` + store.tableName + `.` + COLUMN_CREATED_AT +
+		` OR (previous.` + COLUMN_CREATED_AT + ` = ` + store.tableName + `.` + COLUMN_CREATED_AT +
+		` AND previous.` + COLUMN_ID + ` <= ` + store.tableName + `.` + COLUMN_ID + `)))`
+
+	if _, err := store.exec(ctx, sqlStr); err != nil {
+		if store.debugEnabled {
+			store.logger.Error("MigrateUp: numbering versions failed", "error", err)
+		}
+		return err
+	}
+
+	return store.createVersionNumberIndex(ctx)
+}
+
+// migrateContentHash fills the content hash of the versions created before
+// content hashes existed. The hashes are computed here rather than in SQL,
+// as not every database has SHA-256, a batch at a time.
+func (store *storeImplementation) migrateContentHash(ctx context.Context) error {
+	sqlStr := `SELECT ` + COLUMN_ID + `, ` + COLUMN_ENTITY_TYPE + `, ` + COLUMN_CONTENT + ` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_CONTENT_HASH + ` = '' LIMIT ?`
+
+	for {
+		versions, err := store.queryVersions(ctx, sqlStr, DEFAULT_PRUNE_BATCH_SIZE)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			_, err := store.exec(ctx, `UPDATE `+store.tableName+` SET `+COLUMN_CONTENT_HASH+` = ? WHERE `+COLUMN_ID+` = ?`,
+				store.versionContentHash(version.EntityType(), version.Content()), version.ID())
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(versions) < DEFAULT_PRUNE_BATCH_SIZE {
+			return nil
+		}
+	}
+}
+
+// createVersionNumberIndex creates the unique index guaranteeing that no two
+// versions of an entity share a version number. The SQL is written by hand
+// because the schema builder emits a plain index for Unique on SQLite.
+func (store *storeImplementation) createVersionNumberIndex(ctx context.Context) error {
+	sqlStr := `CREATE UNIQUE INDEX ` + store.tableName + `_version_number_unique ON ` + store.tableName +
+		` (` + COLUMN_ENTITY_TYPE + `, ` + COLUMN_ENTITY_ID + `, ` + COLUMN_VERSION_NUMBER + `)`
+
+	if _, err := store.exec(ctx, sqlStr); err != nil {
+		if store.debugEnabled {
+			store.logger.Error("MigrateUp: creating version number index failed", "error", err)
+		}
+		return err
+	}
+
 	return nil
 }
 
+// versionNumberTaken returns true if the error is the rejection of a
+// version by the unique index on version numbers, meaning a concurrent
+// writer took its number. SQLite names the columns of the index rather
+// than the index.
+func (store *storeImplementation) versionNumberTaken(err error) bool {
+	msg := err.Error()
+	if strings.Contains(msg, store.tableName+`_version_number_unique`) {
+		return true
+	}
+
+	return strings.Contains(msg, `UNIQUE constraint failed: `+
+		store.tableName+`.`+COLUMN_ENTITY_TYPE+`, `+
+		store.tableName+`.`+COLUMN_ENTITY_ID+`, `+
+		store.tableName+`.`+COLUMN_VERSION_NUMBER)
+}
+
 // MigrateDown drops the table
 func (store *storeImplementation) MigrateDown(ctx context.Context, tx ...*sql.Tx) error {
-	if !store.db.Schema().HasTable(store.tableName) {
+	if len(tx) > 0 && tx[0] != nil {
+		return store.WithTx(tx[0]).MigrateDown(ctx)
+	}
+
+	if err := store.blobMigrateDown(ctx); err != nil {
+		return err
+	}
+
+	if err := store.erasureMigrateDown(ctx); err != nil {
+		return err
+	}
+
+	if err := store.holdMigrateDown(ctx); err != nil {
+		return err
+	}
+
+	if err := store.tagMigrateDown(ctx); err != nil {
+		return err
+	}
+
+	if err := store.changesetMigrateDown(ctx); err != nil {
+		return err
+	}
+
+	hasTable, err := store.schemaHasTable(ctx, store.tableName)
+	if err != nil {
+		return err
+	}
+
+	if !hasTable {
 		if store.debugEnabled {
 			store.logger.Info("MigrateDown: table does not exist", "table", store.tableName)
 		}
 		return nil
 	}
 
-	err := store.db.Schema().Drop(store.tableName)
+	err = store.schemaDrop(ctx, store.tableName)
 	if err != nil {
 		if store.debugEnabled {
 			store.logger.Error("MigrateDown failed", "error", err)
@@ -153,18 +540,76 @@ func (store *storeImplementation) VersionCount(ctx context.Context, options Vers
 		return 0, errors.New("ctx is nil")
 	}
 
-	q := store.buildQuery(options)
+	sqlStr, args, err := toSelectSQL(store.buildQuery(options).Table(store.tableName).Select(COLUMN_ID))
+	if err != nil {
+		return 0, err
+	}
 
 	var count int64
-	err := q.Table(store.tableName).Count(&count)
+	err = store.queryRow(ctx, `SELECT COUNT(*) FROM (`+sqlStr+`) counted`, args...).Scan(&count)
 	return count, err
 }
 
+// VersionCreateOptions define the optional checks applied by VersionCreate
+type VersionCreateOptions struct {
+	// ExpectedParentID, when set, makes the create fail with
+	// ErrVersionConflict unless the latest non soft deleted version of the
+	// entity on the version's branch has this ID
+	ExpectedParentID string
+
+	// ExpectedParentNumber, when set, makes the create fail with
+	// ErrVersionConflict unless the latest non soft deleted version of the
+	// entity on the version's branch has this version number
+	ExpectedParentNumber int64
+}
+
 // VersionCreate creates a new version
-func (store *storeImplementation) VersionCreate(ctx context.Context, version VersionInterface) error {
+func (store *storeImplementation) VersionCreate(ctx context.Context, version VersionInterface, opts ...VersionCreateOptions) error {
 	if ctx == nil {
 		return errors.New("ctx is nil")
 	}
+	if err := versionValidate(version); err != nil {
+		return err
+	}
+
+	store.versionDefaults(ctx, version)
+
+	options := VersionCreateOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	if err := store.versionResolveParent(ctx, version, options); err != nil {
+		return err
+	}
+
+	if store.skipUnchangedContent {
+		head, err := store.versionUnchangedHead(ctx, version, options)
+		if err != nil {
+			return err
+		}
+		if head != nil {
+			versionCopy(version, head)
+			return nil
+		}
+	}
+
+	if store.blobTableName == "" {
+		return store.versionInsert(ctx, version, options)
+	}
+
+	// the blob is written with the version, so that a failed insert does
+	// not leave its reference counted
+	return store.transaction(ctx, func(txStore *storeImplementation) error {
+		if err := txStore.blobAcquire(ctx, version.ContentHash(), version.Content()); err != nil {
+			return err
+		}
+		return txStore.versionInsert(ctx, version, options)
+	})
+}
+
+// versionValidate checks the fields a version must have to be created
+func versionValidate(version VersionInterface) error {
 	if version == nil {
 		return errors.New("version store: version cannot be nil")
 	}
@@ -177,6 +622,12 @@ func (store *storeImplementation) VersionCreate(ctx context.Context, version Ver
 	if version.EntityID() == "" {
 		return errors.New("version store: version entity id should not be empty")
 	}
+	return nil
+}
+
+// versionDefaults fills in the fields of a validated version left empty and
+// computes its content hash
+func (store *storeImplementation) versionDefaults(ctx context.Context, version VersionInterface) {
 	if version.GetCreatedAt() == "" {
 		version.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
 	}
@@ -184,16 +635,266 @@ func (store *storeImplementation) VersionCreate(ctx context.Context, version Ver
 		version.SetSoftDeletedAt(MAX_DATETIME)
 	}
 
-	row := map[string]any{
-		COLUMN_ID:              version.ID(),
-		COLUMN_ENTITY_TYPE:     version.EntityType(),
-		COLUMN_ENTITY_ID:       version.EntityID(),
-		COLUMN_CONTENT:         version.Content(),
-		COLUMN_CREATED_AT:      version.GetCreatedAtCarbon().StdTime(),
-		COLUMN_SOFT_DELETED_AT: version.GetSoftDeletedAtCarbon().StdTime(),
+	if version.Branch() == "" {
+		version.SetBranch(DEFAULT_BRANCH)
+	}
+
+	if version.AuthorID() == "" {
+		version.SetAuthorID(ActorFromContext(ctx))
+	}
+
+	version.SetContentHash(store.versionContentHash(version.EntityType(), version.Content()))
+}
+
+// versionInsert inserts a validated version, assigning its version number.
+//
+// The version number and the expected parent checks are evaluated inside the
+// INSERT itself, so concurrent writers cannot both claim the same number or
+// both pass the same parent check; the unique index on (entity_type,
+// entity_id, version_number) rejects any that slip through.
+func (store *storeImplementation) versionInsert(ctx context.Context, version VersionInterface, options VersionCreateOptions) error {
+	stored, err := store.contentEncode(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	stored, err = store.contentSeal(versionOwner(version), stored, store.compressor)
+	if err != nil {
+		return err
+	}
+
+	columns := versionInsertColumns()
+	args := versionInsertArgs(version, stored)
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+
+	sqlStr := `INSERT INTO ` + store.tableName + ` (` + strings.Join(columns, ", ") + `, ` + COLUMN_VERSION_NUMBER + `)` +
+		` SELECT ` + placeholders + `, next_version.number` +
+		` FROM (SELECT COALESCE(MAX(` + COLUMN_VERSION_NUMBER + `), 0) + 1 AS number FROM ` + store.tableName +
+		` WHERE ` + COLUMN_ENTITY_TYPE + ` = ? AND ` + COLUMN_ENTITY_ID + ` = ?) next_version`
+	args = append(args, version.EntityType(), version.EntityID())
+
+	conditions := []string{}
+	if options.ExpectedParentID != "" {
+		conditions = append(conditions, `(`+store.latestColumnSQL(COLUMN_ID)+`) = ?`)
+		args = append(args, version.EntityType(), version.EntityID(), version.Branch(), toDateTimeString(carbon.Now(carbon.UTC)), options.ExpectedParentID)
+	}
+	if options.ExpectedParentNumber > 0 {
+		conditions = append(conditions, `(`+store.latestColumnSQL(COLUMN_VERSION_NUMBER)+`) = ?`)
+		args = append(args, version.EntityType(), version.EntityID(), version.Branch(), toDateTimeString(carbon.Now(carbon.UTC)), options.ExpectedParentNumber)
+	}
+	// a version created soft deleted, or scheduled to expire, deletes
+	// from the history of the entity
+	deleting := version.GetSoftDeletedAt() != MAX_DATETIME
+	if deleting {
+		conditions = append(conditions, store.holdEntityNotExistsSQL())
+		args = append(args, version.EntityType(), version.EntityID())
+	}
+	if len(conditions) > 0 {
+		sqlStr += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	result, err := store.exec(ctx, sqlStr, args...)
+	if err != nil {
+		// a concurrent writer claimed the number first
+		if store.versionNumberTaken(err) {
+			return ErrVersionConflict
+		}
+		if len(conditions) > 0 && store.versionParentMoved(ctx, version, options) {
+			return ErrVersionConflict
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if deleting {
+			if err := store.holdCheckEntity(ctx, version.EntityType(), version.EntityID()); err != nil {
+				return err
+			}
+		}
+		return ErrVersionConflict
 	}
 
-	return store.db.Query().Table(store.tableName).Create(row)
+	var versionNumber int64
+	err = store.queryRow(ctx, `SELECT `+COLUMN_VERSION_NUMBER+` FROM `+store.tableName+` WHERE `+COLUMN_ID+` = ?`, version.ID()).
+		Scan(&versionNumber)
+	if err != nil {
+		return err
+	}
+
+	version.SetVersionNumber(versionNumber)
+
+	return nil
+}
+
+// versionInsertColumns returns the columns written when inserting a
+// version, the version number aside
+func versionInsertColumns() []string {
+	return []string{
+		COLUMN_ID,
+		COLUMN_ENTITY_TYPE,
+		COLUMN_ENTITY_ID,
+		COLUMN_PARENT_ID,
+		COLUMN_MERGE_PARENT_ID,
+		COLUMN_BRANCH,
+		COLUMN_RESTORED_FROM,
+		COLUMN_AUTHOR_ID,
+		COLUMN_MESSAGE,
+		COLUMN_METADATA,
+		COLUMN_CHANGESET_ID,
+		COLUMN_CONTENT,
+		COLUMN_CONTENT_HASH,
+		COLUMN_CONTENT_CODEC,
+		COLUMN_DELTA_BASE_ID,
+		COLUMN_DELTA_DEPTH,
+		COLUMN_CONTENT_COMPRESSION,
+		COLUMN_CONTENT_KEY_ID,
+		COLUMN_CREATED_AT,
+		COLUMN_SOFT_DELETED_AT,
+	}
+}
+
+// versionInsertArgs returns the values of the insert columns of a version
+// whose content is stored as given
+func versionInsertArgs(version VersionInterface, stored storedContent) []any {
+	return []any{
+		version.ID(),
+		version.EntityType(),
+		version.EntityID(),
+		version.ParentID(),
+		version.MergeParentID(),
+		version.Branch(),
+		version.RestoredFrom(),
+		version.AuthorID(),
+		version.Message(),
+		versionMetadata(version),
+		version.ChangesetID(),
+		stored.content,
+		version.ContentHash(),
+		stored.codec,
+		stored.baseID,
+		stored.depth,
+		stored.compression,
+		stored.keyID,
+		toDateTimeString(version.GetCreatedAtCarbon()),
+		toDateTimeString(version.GetSoftDeletedAtCarbon()),
+	}
+}
+
+// versionResolveParent links the version to its parent. Without an explicit
+// parent the version continues from the expected parent if one is given
+// (verified by the insert itself), otherwise from the latest version on the
+// same branch. An explicit parent must be a version of the same entity.
+func (store *storeImplementation) versionResolveParent(ctx context.Context, version VersionInterface, options VersionCreateOptions) error {
+	if version.ParentID() == "" && options.ExpectedParentID != "" {
+		version.SetParentID(options.ExpectedParentID)
+		return nil
+	}
+
+	if version.ParentID() == "" {
+		head, err := store.versionFindOne(ctx, NewVersionQuery().
+			SetEntityType(version.EntityType()).
+			SetEntityID(version.EntityID()).
+			SetBranch(version.Branch()).
+			SetOrderBy(COLUMN_VERSION_NUMBER).
+			SetSortOrder("desc"))
+		if err != nil {
+			return err
+		}
+		if head != nil {
+			version.SetParentID(head.ID())
+		}
+		return nil
+	}
+
+	parent, err := store.versionFindOne(ctx, NewVersionQuery().
+		SetID(version.ParentID()).
+		SetSoftDeletedIncluded(true))
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return errors.New("version store: parent version not found")
+	}
+	if parent.EntityType() != version.EntityType() || parent.EntityID() != version.EntityID() {
+		return errors.New("version store: parent version belongs to another entity")
+	}
+
+	return nil
+}
+
+// versionUnchangedHead returns the head of the version's branch if the
+// version would only repeat it: it continues from the head with identical
+// content and records neither a merge nor a restore. Versions whose expected
+// parent is not the head are left to the insert to reject.
+func (store *storeImplementation) versionUnchangedHead(ctx context.Context, version VersionInterface, options VersionCreateOptions) (VersionInterface, error) {
+	if version.ParentID() == "" || version.MergeParentID() != "" || version.RestoredFrom() != "" {
+		return nil, nil
+	}
+
+	head, err := store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(version.EntityType()).
+		SetEntityID(version.EntityID()).
+		SetBranch(version.Branch()).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("desc"))
+	if err != nil {
+		return nil, err
+	}
+
+	if head == nil || head.ID() != version.ParentID() || head.ContentHash() != version.ContentHash() {
+		return nil, nil
+	}
+
+	if options.ExpectedParentID != "" && options.ExpectedParentID != head.ID() {
+		return nil, nil
+	}
+
+	if options.ExpectedParentNumber > 0 && options.ExpectedParentNumber != head.VersionNumber() {
+		return nil, nil
+	}
+
+	return head, nil
+}
+
+// latestColumnSQL returns a subquery selecting the column of the latest non
+// soft deleted version of an entity on a branch. It takes the entity type,
+// the entity id, the branch and the current datetime as arguments.
+func (store *storeImplementation) latestColumnSQL(column string) string {
+	return `SELECT ` + column + ` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_ENTITY_TYPE + ` = ? AND ` + COLUMN_ENTITY_ID + ` = ?` +
+		` AND ` + COLUMN_BRANCH + ` = ?` +
+		` AND ` + COLUMN_SOFT_DELETED_AT + ` > ?` +
+		` ORDER BY ` + COLUMN_VERSION_NUMBER + ` DESC LIMIT 1`
+}
+
+// versionParentMoved returns true if the latest version of the entity on
+// the version's branch no longer matches the expected parent. It is used to
+// tell a concurrent writer that won the race (reported by the unique index)
+// apart from other failures.
+func (store *storeImplementation) versionParentMoved(ctx context.Context, version VersionInterface, options VersionCreateOptions) bool {
+	latest, err := store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(version.EntityType()).
+		SetEntityID(version.EntityID()).
+		SetBranch(version.Branch()).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("desc"))
+	if err != nil {
+		return false
+	}
+	if latest == nil {
+		return true
+	}
+
+	if options.ExpectedParentID != "" && latest.ID() != options.ExpectedParentID {
+		return true
+	}
+
+	return options.ExpectedParentNumber > 0 && latest.VersionNumber() != options.ExpectedParentNumber
 }
 
 // VersionDelete deletes a version permanently
@@ -217,11 +918,225 @@ func (store *storeImplementation) VersionDeleteByID(ctx context.Context, id stri
 		return errors.New("version id is empty")
 	}
 
-	_, err := store.db.Query().
-		Table(store.tableName).
-		Where(COLUMN_ID+" = ?", id).
-		Delete()
-	return err
+	return store.versionDeleteBatch(ctx, []string{id}, true)
+}
+
+// VersionDeleteByQueryOptions define the options of the delete by query
+// methods
+type VersionDeleteByQueryOptions struct {
+	// Force allows a query without filters, or filtering only by time,
+	// version number or message, which can delete every version
+	Force bool
+
+	// VersionBatchOptions set the number of versions deleted by each
+	// statement
+	VersionBatchOptions
+}
+
+// VersionDeleteByQuery deletes permanently the versions matching the query,
+// in a single transaction, and returns the number of versions deleted. A
+// query filtering by none of the id, entity, content hash, author, branch
+// or metadata fails with ErrUnfilteredQuery unless forced.
+func (store *storeImplementation) VersionDeleteByQuery(ctx context.Context, query VersionQueryInterface, opts ...VersionDeleteByQueryOptions) (int64, error) {
+	return store.versionDeleteByQuery(ctx, query, true, opts)
+}
+
+// VersionSoftDeleteByQuery soft deletes the versions matching the query, in
+// a single transaction, and returns the number of versions soft deleted.
+// Versions already soft deleted are left as they are. A query filtering by
+// none of the id, entity, content hash, author, branch or metadata fails
+// with ErrUnfilteredQuery unless forced.
+func (store *storeImplementation) VersionSoftDeleteByQuery(ctx context.Context, query VersionQueryInterface, opts ...VersionDeleteByQueryOptions) (int64, error) {
+	return store.versionDeleteByQuery(ctx, query, false, opts)
+}
+
+// versionDeleteByQuery deletes, or soft deletes, the versions matching the
+// query in chunks
+func (store *storeImplementation) versionDeleteByQuery(ctx context.Context, query VersionQueryInterface, hardDelete bool, opts []VersionDeleteByQueryOptions) (int64, error) {
+	if ctx == nil {
+		return 0, errors.New("ctx is nil")
+	}
+	if query == nil {
+		return 0, errors.New("version store: query is required")
+	}
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+
+	options := VersionDeleteByQueryOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	if !versionQueryHasFilter(query) && !options.Force {
+		return 0, ErrUnfilteredQuery
+	}
+
+	q := store.buildQuery(query).Table(store.tableName).Select(COLUMN_ID)
+	if !hardDelete {
+		q = q.Where(COLUMN_SOFT_DELETED_AT+" > ?", toDateTimeString(carbon.Now(carbon.UTC)))
+	}
+
+	sqlStr, args, err := toSelectSQL(q)
+	if err != nil {
+		return 0, err
+	}
+
+	chunkSize := batchChunkSize([]VersionBatchOptions{options.VersionBatchOptions}, batchDeleteParameters)
+
+	var deleted int64
+	err = store.transaction(ctx, func(txStore *storeImplementation) error {
+		rows, err := txStore.query(ctx, sqlStr, args...)
+		if err != nil {
+			return err
+		}
+
+		ids := []string{}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for start := 0; start < len(ids); start += chunkSize {
+			if err := txStore.versionDeleteBatch(ctx, ids[start:min(start+chunkSize, len(ids))], hardDelete); err != nil {
+				return err
+			}
+		}
+
+		deleted = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// versionDeleteBatch soft deletes, or hard deletes, the versions with the
+// given ids in a single statement. Every hard delete goes through here, so
+// that legal holds are enforced, blobs no longer referenced are collected,
+// deltas encoded against the deleted versions are stored whole and the tags
+// on the deleted versions are removed. The holds are checked by the
+// statement itself, so that a hold placed concurrently cannot be missed.
+// Some of its statements bind the ids twice, so callers pass at most
+// batchChunkSize(opts, batchDeleteParameters) ids.
+func (store *storeImplementation) versionDeleteBatch(ctx context.Context, ids []string, hardDelete bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	args := []any{}
+	sqlStr := `DELETE FROM ` + store.tableName
+
+	if !hardDelete {
+		sqlStr = `UPDATE ` + store.tableName + ` SET ` + COLUMN_SOFT_DELETED_AT + ` = ?`
+		args = append(args, toDateTimeString(carbon.Now(carbon.UTC)))
+	}
+
+	sqlStr += ` WHERE ` + COLUMN_ID + ` IN (` + placeholders + `)` +
+		` AND ` + store.holdNotExistsSQL()
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	return store.transaction(ctx, func(txStore *storeImplementation) error {
+		if hardDelete && txStore.contentCodec != nil {
+			if err := txStore.contentDetach(ctx, ids); err != nil {
+				return err
+			}
+		}
+
+		if hardDelete && txStore.blobTableName != "" {
+			if err := txStore.blobRelease(ctx, ids); err != nil {
+				return err
+			}
+		}
+
+		result, err := txStore.exec(ctx, sqlStr, args...)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// versions left out are either missing or held, the transaction
+		// is rolled back if any is held
+		if deleted < int64(len(ids)) {
+			if err := txStore.holdCheckVersions(ctx, ids); err != nil {
+				return err
+			}
+		}
+
+		if !hardDelete {
+			return nil
+		}
+
+		if err := txStore.tagRemoveFromVersions(ctx, ids); err != nil {
+			return err
+		}
+
+		if txStore.blobTableName != "" {
+			return txStore.blobCollect(ctx)
+		}
+
+		return nil
+	})
+}
+
+// VersionFindByHash returns the non soft deleted versions, of any entity,
+// whose content has the given hash, as returned by Version.ContentHash
+func (store *storeImplementation) VersionFindByHash(ctx context.Context, contentHash string) ([]VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if contentHash == "" {
+		return nil, errors.New("version store: content hash is required")
+	}
+
+	return store.VersionList(ctx, NewVersionQuery().
+		SetContentHash(contentHash).
+		SetOrderBy(COLUMN_CREATED_AT).
+		SetSortOrder("asc"))
+}
+
+// VersionExpireAt schedules a version to be soft deleted at the given time.
+// The version stays listed until then. The zero time cancels the expiry.
+func (store *storeImplementation) VersionExpireAt(ctx context.Context, id string, expiresAt time.Time) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+	if id == "" {
+		return errors.New("version id is empty")
+	}
+
+	version, err := store.VersionFindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return errors.New("version not found")
+	}
+
+	// VersionUpdate checks the legal holds, as part of the update
+	version.SetExpiresAt(expiresAt)
+
+	return store.VersionUpdate(ctx, version)
 }
 
 // VersionFindByID finds a version by ID
@@ -240,46 +1155,130 @@ func (store *storeImplementation) VersionFindByID(ctx context.Context, id string
 	return nil, nil
 }
 
-// VersionList returns a list of versions matching the query options
-func (store *storeImplementation) VersionList(ctx context.Context, options VersionQueryInterface) ([]VersionInterface, error) {
+// VersionFindByNumber finds the version of an entity with the given version number
+func (store *storeImplementation) VersionFindByNumber(ctx context.Context, entityType string, entityID string, versionNumber int64) (VersionInterface, error) {
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+	if versionNumber < 1 {
+		return nil, errors.New("version store: version number must be greater than 0")
+	}
+
+	return store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(entityType).
+		SetEntityID(entityID).
+		SetVersionNumber(versionNumber))
+}
+
+// VersionFirst returns the oldest non soft deleted version of an entity
+func (store *storeImplementation) VersionFirst(ctx context.Context, entityType string, entityID string) (VersionInterface, error) {
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+
+	return store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(entityType).
+		SetEntityID(entityID).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+}
+
+// VersionLatest returns the newest non soft deleted version of an entity
+func (store *storeImplementation) VersionLatest(ctx context.Context, entityType string, entityID string) (VersionInterface, error) {
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+
+	return store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(entityType).
+		SetEntityID(entityID).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("desc"))
+}
+
+// VersionAsOf returns the latest version of an entity as it was at the
+// given moment: created at or before it and not soft deleted then, even if
+// it was soft deleted since
+func (store *storeImplementation) VersionAsOf(ctx context.Context, entityType string, entityID string, asOf time.Time) (VersionInterface, error) {
 	if ctx == nil {
 		return nil, errors.New("ctx is nil")
 	}
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+	if asOf.IsZero() {
+		return nil, errors.New("version store: as of time is required")
+	}
+
+	return store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(entityType).
+		SetEntityID(entityID).
+		SetAsOf(asOf).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("desc"))
+}
 
-	type versionRow struct {
-		ID            string    `db:"id"`
-		EntityType    string    `db:"entity_type"`
-		EntityID      string    `db:"entity_id"`
-		Content       string    `db:"content"`
-		CreatedAt     time.Time `db:"created_at"`
-		SoftDeletedAt time.Time `db:"soft_deleted_at"`
+// VersionList returns a list of versions matching the query options
+func (store *storeImplementation) VersionList(ctx context.Context, options VersionQueryInterface) ([]VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
 	}
 
 	q := store.buildQuery(options)
 	q = q.Table(store.tableName)
 
 	if len(options.Columns()) > 0 {
-		q = q.Select(options.Columns())
+		q = q.Select(versionSelectColumns(options.Columns()))
 	}
 
-	var rows []versionRow
-	if err := q.Get(&rows); err != nil {
+	list, err := store.selectVersions(ctx, q)
+	if err != nil {
 		return []VersionInterface{}, err
 	}
 
-	list := make([]VersionInterface, 0, len(rows))
-	for _, r := range rows {
-		v := &version{}
-		v.SetID(r.ID)
-		v.SetEntityType(r.EntityType)
-		v.SetEntityID(r.EntityID)
-		v.SetContent(r.Content)
-		v.CreatedAt.CreatedAt = r.CreatedAt
-		v.SoftDeletedAt = r.SoftDeletedAt
-		list = append(list, v)
+	return list, nil
+}
+
+// VersionNext returns the non soft deleted version of the same entity
+// directly following the given one, or nil if it is the latest
+func (store *storeImplementation) VersionNext(ctx context.Context, version VersionInterface) (VersionInterface, error) {
+	if version == nil {
+		return nil, errors.New("version is nil")
 	}
 
-	return list, nil
+	return store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(version.EntityType()).
+		SetEntityID(version.EntityID()).
+		SetVersionNumberGreaterThan(version.VersionNumber()).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+}
+
+// VersionPrevious returns the non soft deleted version of the same entity
+// directly preceding the given one, or nil if it is the first
+func (store *storeImplementation) VersionPrevious(ctx context.Context, version VersionInterface) (VersionInterface, error) {
+	if version == nil {
+		return nil, errors.New("version is nil")
+	}
+
+	return store.versionFindOne(ctx, NewVersionQuery().
+		SetEntityType(version.EntityType()).
+		SetEntityID(version.EntityID()).
+		SetVersionNumberLessThan(version.VersionNumber()).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("desc"))
 }
 
 // VersionSoftDelete soft deletes a version
@@ -291,6 +1290,10 @@ func (store *storeImplementation) VersionSoftDelete(ctx context.Context, version
 		return errors.New("version is nil")
 	}
 
+	if err := store.holdCheckEntity(ctx, version.EntityType(), version.EntityID()); err != nil {
+		return err
+	}
+
 	version.SetSoftDeletedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
 
 	return store.VersionUpdate(ctx, version)
@@ -316,7 +1319,8 @@ func (store *storeImplementation) VersionSoftDeleteByID(ctx context.Context, id
 	return store.VersionSoftDelete(ctx, version)
 }
 
-// VersionUpdate updates a version
+// VersionUpdate updates a version. It fails with a *LegalHoldError if the
+// version is soft deleted, or expires, while its entity is under legal hold.
 //
 // Note!! There is no reason to call this method other than marking
 // the version as soft deleted
@@ -328,23 +1332,61 @@ func (store *storeImplementation) VersionUpdate(ctx context.Context, version Ver
 		return errors.New("version is nil")
 	}
 
-	row := map[string]any{
-		COLUMN_SOFT_DELETED_AT: version.GetSoftDeletedAtCarbon().StdTime(),
+	softDeletedAt := toDateTimeString(version.GetSoftDeletedAtCarbon())
+
+	sqlStr := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_SOFT_DELETED_AT + ` = ?` +
+		` WHERE ` + COLUMN_ID + ` = ?`
+
+	// only restoring a version, or cancelling its expiry, is allowed under
+	// legal hold. The hold is checked by the update itself, so that a hold
+	// placed concurrently cannot be missed.
+	if softDeletedAt == MAX_DATETIME {
+		_, err := store.exec(ctx, sqlStr, softDeletedAt, version.ID())
+		return err
 	}
 
-	_, err := store.db.Query().Table(store.tableName).Where(COLUMN_ID+" = ?", version.ID()).Update(row)
-	return err
+	sqlStr += ` AND ` + store.holdNotExistsSQL()
+
+	return store.transaction(ctx, func(txStore *storeImplementation) error {
+		result, err := txStore.exec(ctx, sqlStr, softDeletedAt, version.ID())
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			return nil
+		}
+
+		return txStore.holdCheckVersions(ctx, []string{version.ID()})
+	})
+}
+
+// versionFindOne returns the first version matching the query, or nil if
+// there is none
+func (store *storeImplementation) versionFindOne(ctx context.Context, query VersionQueryInterface) (VersionInterface, error) {
+	list, err := store.VersionList(ctx, query.SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(list) > 0 {
+		return list[0], nil
+	}
+	return nil, nil
 }
 
 // == QUERY BUILDER ==========================================================
 
 // buildQuery builds a neat query from the version query interface.
 func (store *storeImplementation) buildQuery(options VersionQueryInterface) contractsorm.Query {
-	// Use Model() to enable neat's automatic soft delete handling via SoftDeletesMaxDate
 	q := store.db.Query().Model(&version{})
 
 	if options == nil {
-		return q
+		options = NewVersionQuery()
 	}
 
 	if options.HasID() && options.ID() != "" {
@@ -359,6 +1401,43 @@ func (store *storeImplementation) buildQuery(options VersionQueryInterface) cont
 		q = q.Where(COLUMN_ENTITY_ID+" = ?", options.EntityID())
 	}
 
+	if options.HasParentID() {
+		q = q.Where(COLUMN_PARENT_ID+" = ?", options.ParentID())
+	}
+
+	if options.HasContentHash() && options.ContentHash() != "" {
+		q = q.Where(COLUMN_CONTENT_HASH+" = ?", options.ContentHash())
+	}
+
+	if options.HasAuthorID() && options.AuthorID() != "" {
+		q = q.Where(COLUMN_AUTHOR_ID+" = ?", options.AuthorID())
+	}
+
+	if options.HasMessageContains() && options.MessageContains() != "" {
+		q = q.Where(COLUMN_MESSAGE+" LIKE ? ESCAPE '!'", "%"+likeEscape(options.MessageContains())+"%")
+	}
+
+	for key, value := range options.Metas() {
+		condition, args := store.metadataConditionSQL(key, value)
+		q = q.Where(condition, args...)
+	}
+
+	if options.HasBranch() && options.Branch() != "" {
+		q = q.Where(COLUMN_BRANCH+" = ?", options.Branch())
+	}
+
+	if options.HasVersionNumber() && options.VersionNumber() > 0 {
+		q = q.Where(COLUMN_VERSION_NUMBER+" = ?", options.VersionNumber())
+	}
+
+	if options.HasVersionNumberGreaterThan() {
+		q = q.Where(COLUMN_VERSION_NUMBER+" > ?", options.VersionNumberGreaterThan())
+	}
+
+	if options.HasVersionNumberLessThan() {
+		q = q.Where(COLUMN_VERSION_NUMBER+" < ?", options.VersionNumberLessThan())
+	}
+
 	if options.HasLimit() && options.Limit() > 0 {
 		q = q.Limit(options.Limit())
 	}
@@ -373,12 +1452,133 @@ func (store *storeImplementation) buildQuery(options VersionQueryInterface) cont
 		} else {
 			q = q.OrderByDesc(options.OrderBy())
 		}
+
+		// created_at has second precision, so versions saved within the same
+		// second are tie-broken by their version number
+		if options.OrderBy() == COLUMN_CREATED_AT {
+			if options.HasSortOrder() && options.SortOrder() == "asc" {
+				q = q.OrderBy(COLUMN_VERSION_NUMBER)
+			} else {
+				q = q.OrderByDesc(COLUMN_VERSION_NUMBER)
+			}
+		}
 	}
 
-	// Handle soft delete filtering via neat's automatic handling (SoftDeletesMaxDate)
-	if options.HasSoftDeletedIncluded() && options.SoftDeletedIncluded() {
-		q = q.WithSoftDeleted()
+	// Soft deleted versions are filtered here instead of by neat, so that the
+	// cutoff is the same UTC, second precision now used by the hand written
+	// statements and by IsSoftDeleted, and versions expiring in the future
+	// stay visible until their second comes
+	q = q.WithSoftDeleted()
+
+	// as of a past moment, the versions created after it do not exist yet
+	// and the versions soft deleted after it are still visible
+	now := toDateTimeString(carbon.Now(carbon.UTC))
+	if options.HasAsOf() {
+		now = toDateTimeString(carbon.CreateFromStdTime(options.AsOf().UTC()))
+		q = q.Where(COLUMN_CREATED_AT+" <= ?", now)
+	}
+
+	switch {
+	case options.HasSoftDeletedOnly() && options.SoftDeletedOnly():
+		q = q.Where(COLUMN_SOFT_DELETED_AT+" <= ?", now)
+	case options.HasSoftDeletedIncluded() && options.SoftDeletedIncluded():
+		// all versions
+	default:
+		q = q.Where(COLUMN_SOFT_DELETED_AT+" > ?", now)
 	}
 
 	return q
 }
+
+// versionMetadata returns the metadata of a version as stored, a JSON
+// object of strings or empty
+func versionMetadata(v VersionInterface) string {
+	if stored, ok := v.(*version); ok {
+		return stored.MetadataField
+	}
+
+	metas := v.Metas()
+	if len(metas) == 0 {
+		return ""
+	}
+
+	data, _ := json.Marshal(metas)
+	return string(data)
+}
+
+// versionSelectColumns returns the columns to select for the given ones.
+// The stored content may be a delta, compressed, encrypted or kept in the
+// blob table, so selecting it also selects the columns needed to read it.
+func versionSelectColumns(columns []string) []string {
+	if !containsString(columns, COLUMN_CONTENT) {
+		return columns
+	}
+
+	selected := append([]string{}, columns...)
+	for _, column := range []string{COLUMN_ID, COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID, COLUMN_CONTENT_HASH, COLUMN_CONTENT_CODEC, COLUMN_DELTA_BASE_ID, COLUMN_CONTENT_COMPRESSION, COLUMN_CONTENT_KEY_ID} {
+		if !containsString(selected, column) {
+			selected = append(selected, column)
+		}
+	}
+
+	return selected
+}
+
+// versionQueryHasFilter returns true if the query narrows the versions it
+// matches by what they are: their id, entity, content hash, author, branch
+// or metadata. Time and version number ranges, or message searches, alone
+// can match every version.
+func versionQueryHasFilter(query VersionQueryInterface) bool {
+	return (query.HasID() && query.ID() != "") ||
+		(query.HasEntityType() && query.EntityType() != "") ||
+		(query.HasEntityID() && query.EntityID() != "") ||
+		(query.HasContentHash() && query.ContentHash() != "") ||
+		(query.HasAuthorID() && query.AuthorID() != "") ||
+		(query.HasBranch() && query.Branch() != "") ||
+		len(query.Metas()) > 0
+}
+
+// likeEscape escapes the LIKE wildcards in s, for patterns using ! as their
+// escape character
+func likeEscape(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// contentHash returns the hex encoded SHA-256 hash of a content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// versionContentHash returns the content hash of a version of the given
+// entity type: keyed with the content hash key when the entity type is
+// encrypted, as a plain hash would let its content be guessed
+func (store *storeImplementation) versionContentHash(entityType string, content string) string {
+	if store.encryptor == nil || !store.encryptedEntityTypes[entityType] {
+		return contentHash(content)
+	}
+
+	mac := hmac.New(sha256.New, store.contentHashKey)
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// versionCopy overwrites a version with the fields of another
+func versionCopy(dst VersionInterface, src VersionInterface) {
+	dst.SetID(src.ID()).
+		SetEntityType(src.EntityType()).
+		SetEntityID(src.EntityID()).
+		SetParentID(src.ParentID()).
+		SetMergeParentID(src.MergeParentID()).
+		SetBranch(src.Branch()).
+		SetRestoredFrom(src.RestoredFrom()).
+		SetAuthorID(src.AuthorID()).
+		SetMessage(src.Message()).
+		SetMetas(src.Metas()).
+		SetChangesetID(src.ChangesetID()).
+		SetContent(src.Content()).
+		SetContentHash(src.ContentHash()).
+		SetVersionNumber(src.VersionNumber()).
+		SetCreatedAt(src.GetCreatedAt()).
+		SetSoftDeletedAt(src.GetSoftDeletedAt())
+}
@@ -3,6 +3,7 @@ package versionstore
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"os"
 	"strings"
 	"testing"
@@ -484,3 +485,907 @@ func TestStoreVersionList_Ordering(t *testing.T) {
 		t.Fatal("Second version MUST be 'content1' (oldest) with DESC order. Got:", versionList[1].Content())
 	}
 }
+
+func TestStoreVersionCreate_VersionNumber(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_create_version_number",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		version := NewVersion().
+			SetEntityType("webpage").
+			SetEntityID("1").
+			SetContent("content")
+
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if version.VersionNumber() != int64(i) {
+			t.Fatal("Version number MUST be", i, "Found:", version.VersionNumber())
+		}
+	}
+
+	other := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("2").
+		SetContent("content")
+
+	if err := store.VersionCreate(ctx, other); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if other.VersionNumber() != 1 {
+		t.Fatal("Version number of another entity MUST start at 1. Found:", other.VersionNumber())
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetVersionNumber(2))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 {
+		t.Fatal("Version list MUST be 1, got:", len(list))
+	}
+
+	if list[0].VersionNumber() != 2 {
+		t.Fatal("Version number MUST be 2. Found:", list[0].VersionNumber())
+	}
+}
+
+func TestStoreVersionList_OrderingSameSecond(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_list_ordering_same_second",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+	createdAt := "2024-01-01 00:00:00"
+
+	for _, content := range []string{"content1", "content2", "content3"} {
+		version := NewVersion().
+			SetEntityType("webpage").
+			SetEntityID("1").
+			SetContent(content).
+			SetCreatedAt(createdAt)
+
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetOrderBy(COLUMN_CREATED_AT).
+		SetSortOrder("desc"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 3 {
+		t.Fatal("Version list MUST be 3, got:", len(list))
+	}
+
+	if list[0].Content() != "content3" || list[2].Content() != "content1" {
+		t.Fatal("Versions in the same second MUST be ordered by version number. Got:", list[0].Content(), list[1].Content(), list[2].Content())
+	}
+}
+
+func TestStoreMigrateUp_AddsVersionNumber(t *testing.T) {
+	db := initDB(":memory:")
+	tableName := "version_migrate_version_number"
+
+	_, err := db.Exec(`CREATE TABLE ` + tableName + ` (
+		id VARCHAR(21) NOT NULL PRIMARY KEY,
+		entity_type VARCHAR(40) NOT NULL,
+		entity_id VARCHAR(40) NOT NULL,
+		content TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		soft_deleted_at DATETIME NOT NULL
+	)`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO `+tableName+` VALUES
+		('a', 'webpage', '1', 'content1', '2024-01-01 00:00:00', ?),
+		('b', 'webpage', '1', 'content2', '2024-01-02 00:00:00', ?),
+		('c', 'webpage', '2', 'content3', '2024-01-01 00:00:00', ?)`,
+		MAX_DATETIME, MAX_DATETIME, MAX_DATETIME)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          tableName,
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	expected := map[string]int64{"a": 1, "b": 2, "c": 1}
+	for id, number := range expected {
+		version, err := store.VersionFindByID(ctx, id)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if version == nil {
+			t.Fatal("Version MUST NOT be nil:", id)
+		}
+		if version.VersionNumber() != number {
+			t.Fatal("Version", id, "number MUST be", number, "Found:", version.VersionNumber())
+		}
+		if version.ContentHash() != contentHash(version.Content()) {
+			t.Fatal("Version", id, "content hash MUST be filled")
+		}
+	}
+
+	version := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("content4")
+
+	if err := store.VersionCreate(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if version.VersionNumber() != 3 {
+		t.Fatal("Version number MUST be 3. Found:", version.VersionNumber())
+	}
+}
+
+func TestStoreVersionLookups(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_lookups",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	versions := []VersionInterface{}
+	for _, content := range []string{"content1", "content2", "content3", "content4"} {
+		version := NewVersion().
+			SetEntityType("webpage").
+			SetEntityID("1").
+			SetContent(content).
+			SetCreatedAt("2024-01-01 00:00:00")
+
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		versions = append(versions, version)
+	}
+
+	// the soft deleted latest and third versions must be skipped
+	if err := store.VersionSoftDelete(ctx, versions[3]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.VersionSoftDelete(ctx, versions[2]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	latest, err := store.VersionLatest(ctx, "webpage", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if latest == nil || latest.ID() != versions[1].ID() {
+		t.Fatal("Latest version MUST be the second version")
+	}
+
+	first, err := store.VersionFirst(ctx, "webpage", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if first == nil || first.ID() != versions[0].ID() {
+		t.Fatal("First version MUST be the first version")
+	}
+
+	byNumber, err := store.VersionFindByNumber(ctx, "webpage", "1", 2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if byNumber == nil || byNumber.Content() != "content2" {
+		t.Fatal("Version number 2 MUST be 'content2'")
+	}
+
+	deleted, err := store.VersionFindByNumber(ctx, "webpage", "1", 4)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if deleted != nil {
+		t.Fatal("Soft deleted version MUST NOT be found by number")
+	}
+
+	next, err := store.VersionNext(ctx, first)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if next == nil || next.ID() != versions[1].ID() {
+		t.Fatal("Next version MUST be the second version")
+	}
+
+	next, err = store.VersionNext(ctx, latest)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if next != nil {
+		t.Fatal("Next version of the latest MUST be nil")
+	}
+
+	previous, err := store.VersionPrevious(ctx, versions[3])
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if previous == nil || previous.ID() != versions[1].ID() {
+		t.Fatal("Previous version MUST skip soft deleted versions")
+	}
+
+	previous, err = store.VersionPrevious(ctx, first)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if previous != nil {
+		t.Fatal("Previous version of the first MUST be nil")
+	}
+
+	missing, err := store.VersionLatest(ctx, "webpage", "2")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if missing != nil {
+		t.Fatal("Latest version of an unknown entity MUST be nil")
+	}
+}
+
+func TestStoreVersionCreate_VersionNumberTaken(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_create_number_taken",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('version_create_number_taken')`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	columns, values := []string{}, []string{}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		columns = append(columns, column)
+		values = append(values, "NEW."+column)
+		if column == COLUMN_ID {
+			values[len(values)-1] = "'racer'"
+		}
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// a concurrent writer claims the same version number just before the
+	// insert
+	_, err = db.Exec(`CREATE TRIGGER version_create_number_taken_race BEFORE INSERT ON version_create_number_taken` +
+		` WHEN NEW.id <> 'racer'` +
+		` BEGIN INSERT INTO version_create_number_taken (` + strings.Join(columns, ", ") + `) VALUES (` + strings.Join(values, ", ") + `); END`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.VersionCreate(ctx, NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent("content"))
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Version number taken concurrently MUST be a conflict. Found:", err)
+	}
+}
+
+func TestStoreVersionCreate_ExpectedParent(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_create_expected_parent",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	base := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("base")
+
+	if err := store.VersionCreate(ctx, base); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// first editor saves on top of the base version
+	ours := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("ours")
+
+	err = store.VersionCreate(ctx, ours, VersionCreateOptions{ExpectedParentID: base.ID()})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// second editor also started from the base version
+	theirs := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("theirs")
+
+	err = store.VersionCreate(ctx, theirs, VersionCreateOptions{ExpectedParentID: base.ID()})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Error MUST be ErrVersionConflict. Found:", err)
+	}
+
+	err = store.VersionCreate(ctx, theirs, VersionCreateOptions{ExpectedParentNumber: base.VersionNumber()})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Error MUST be ErrVersionConflict. Found:", err)
+	}
+
+	conflicted, err := store.VersionFindByID(ctx, theirs.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if conflicted != nil {
+		t.Fatal("Conflicting version MUST NOT be saved")
+	}
+
+	err = store.VersionCreate(ctx, theirs, VersionCreateOptions{ExpectedParentNumber: ours.VersionNumber()})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if theirs.VersionNumber() != 3 {
+		t.Fatal("Version number MUST be 3. Found:", theirs.VersionNumber())
+	}
+
+	first := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("2").
+		SetContent("first")
+
+	err = store.VersionCreate(ctx, first, VersionCreateOptions{ExpectedParentID: base.ID()})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Error MUST be ErrVersionConflict for an entity without versions. Found:", err)
+	}
+}
+
+func TestStoreVersionCreate_ExpectedParentBranch(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_create_expected_parent_branch",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	main := NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent("main")
+	if err := store.VersionCreate(ctx, main); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	draft := NewVersion().SetEntityType("webpage").SetEntityID("1").SetBranch("draft").SetParentID(main.ID()).SetContent("draft")
+	if err := store.VersionCreate(ctx, draft); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// main advances while the draft is being edited
+	if err := store.VersionCreate(ctx, NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent("main 2")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	edit := NewVersion().SetEntityType("webpage").SetEntityID("1").SetBranch("draft").SetContent("draft 2")
+	if err := store.VersionCreate(ctx, edit, VersionCreateOptions{ExpectedParentID: draft.ID()}); err != nil {
+		t.Fatal("Expected parent MUST be checked against the head of the version's branch. Found:", err)
+	}
+
+	again := NewVersion().SetEntityType("webpage").SetEntityID("1").SetBranch("draft").SetContent("draft 3")
+	if err := store.VersionCreate(ctx, again, VersionCreateOptions{ExpectedParentNumber: edit.VersionNumber()}); err != nil {
+		t.Fatal("Expected parent number MUST be checked against the head of the version's branch. Found:", err)
+	}
+
+	stale := NewVersion().SetEntityType("webpage").SetEntityID("1").SetBranch("draft").SetContent("stale")
+	if err := store.VersionCreate(ctx, stale, VersionCreateOptions{ExpectedParentID: draft.ID()}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Error MUST be ErrVersionConflict once the branch moved. Found:", err)
+	}
+}
+
+func TestStoreVersionExpireAt(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_expire_at",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	expiring := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("expiring").
+		SetExpiresAt(time.Now().Add(time.Hour))
+
+	expired := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("expired").
+		SetExpiresAt(time.Now().Add(-time.Minute))
+
+	for _, version := range []VersionInterface{expiring, expired} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if expiring.IsSoftDeleted() {
+		t.Fatal("Version expiring in the future MUST NOT be soft deleted")
+	}
+
+	if !expired.IsSoftDeleted() {
+		t.Fatal("Version expired in the past MUST be soft deleted")
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("webpage").SetEntityID("1"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].ID() != expiring.ID() {
+		t.Fatal("Only the version expiring in the future MUST be listed. Found:", len(list))
+	}
+
+	if list[0].IsSoftDeleted() || list[0].ExpiresAt().IsZero() {
+		t.Fatal("Listed version MUST keep its expiry")
+	}
+
+	if err := store.VersionExpireAt(ctx, expiring.ID(), time.Time{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.VersionFindByID(ctx, expiring.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || !found.ExpiresAt().IsZero() || found.GetSoftDeletedAt() != MAX_DATETIME {
+		t.Fatal("Expiry MUST be cancelled by the zero time")
+	}
+
+	if err := store.VersionExpireAt(ctx, expiring.ID(), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.VersionFindByID(ctx, expiring.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("Version MUST NOT be found once expired")
+	}
+
+	if err := store.VersionExpireAt(ctx, "missing", time.Now()); err == nil {
+		t.Fatal("Expiring a missing version MUST fail")
+	}
+}
+
+func TestStoreVersionFindByHash(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_find_by_hash",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	page := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("Hello")
+	post := NewVersion().SetEntityType("post").SetEntityID("2").SetContent("Hello")
+	other := NewVersion().SetEntityType("post").SetEntityID("3").SetContent("World")
+
+	for _, version := range []VersionInterface{page, post, other} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	// SHA-256 of "Hello"
+	hash := "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969"
+
+	if page.ContentHash() != hash {
+		t.Fatal("Content hash MUST be the SHA-256 of the content. Found:", page.ContentHash())
+	}
+
+	list, err := store.VersionFindByHash(ctx, hash)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 2 || list[0].ID() != page.ID() || list[1].ID() != post.ID() {
+		t.Fatal("Identical versions of every entity MUST be found. Found:", len(list))
+	}
+
+	if list[0].ContentHash() != hash {
+		t.Fatal("Content hash MUST be stored")
+	}
+}
+
+func TestStoreVersionCreate_SkipUnchangedContent(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                   db,
+		TableName:            "version_skip_unchanged",
+		AutomigrateEnabled:   true,
+		SkipUnchangedContent: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(version VersionInterface) VersionInterface {
+		if err := store.VersionCreate(ctx, version.SetEntityType("webpage").SetEntityID("1")); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	v1 := create(NewVersion().SetContent("same"))
+
+	repeated := NewVersion().SetContent("same")
+	repeatedID := repeated.ID()
+	create(repeated)
+
+	if repeated.ID() != v1.ID() || repeated.VersionNumber() != 1 {
+		t.Fatal("Unchanged content MUST return the existing version")
+	}
+
+	found, err := store.VersionFindByID(ctx, repeatedID)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("Unchanged content MUST NOT create a version")
+	}
+
+	v2 := create(NewVersion().SetContent("changed"))
+	if v2.VersionNumber() != 2 {
+		t.Fatal("Changed content MUST create a version. Found:", v2.VersionNumber())
+	}
+
+	v3 := create(NewVersion().SetContent("same"))
+	if v3.VersionNumber() != 3 {
+		t.Fatal("Content equal to an older version MUST create a version. Found:", v3.VersionNumber())
+	}
+
+	draft := create(NewVersion().SetContent("same").SetBranch("draft").SetParentID(v3.ID()))
+	if draft.VersionNumber() != 4 {
+		t.Fatal("Content equal to the head of another branch MUST create a version. Found:", draft.VersionNumber())
+	}
+
+	err = store.VersionCreate(ctx, NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("same"), VersionCreateOptions{ExpectedParentID: v2.ID()})
+
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatal("Unchanged content with a stale expected parent MUST conflict. Found:", err)
+	}
+}
+
+func TestStoreVersionAsOf(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_as_of",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	versions := []VersionInterface{
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("v1").SetCreatedAt("2026-01-01 10:00:00"),
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("v2").SetCreatedAt("2026-02-01 10:00:00"),
+		NewVersion().SetEntityType("page").SetEntityID("2").SetContent("other").SetCreatedAt("2026-02-15 10:00:00"),
+		NewVersion().SetEntityType("page").SetEntityID("1").SetContent("v3").SetCreatedAt("2026-04-01 10:00:00"),
+	}
+	for _, version := range versions {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if _, err := db.Exec(`UPDATE version_as_of SET soft_deleted_at = '2026-03-15 00:00:00' WHERE id = ?`, versions[1].ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	cases := []struct {
+		asOf    string
+		content string
+	}{
+		{"2025-12-31 23:59:59", ""},
+		{"2026-01-01 10:00:00", "v1"},
+		{"2026-03-01 14:00:00", "v2"},
+		{"2026-03-20 00:00:00", "v1"},
+		{"2026-05-01 00:00:00", "v3"},
+	}
+
+	for _, c := range cases {
+		asOf, err := time.Parse(time.DateTime, c.asOf)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		version, err := store.VersionAsOf(ctx, "page", "1", asOf)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		content := ""
+		if version != nil {
+			content = version.Content()
+		}
+
+		if content != c.content {
+			t.Fatalf("Version as of %s MUST be %q, found %q", c.asOf, c.content, content)
+		}
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("page").
+		SetAsOf(time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)).
+		SetOrderBy(COLUMN_CREATED_AT).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 3 || list[1].Content() != "v2" || list[2].Content() != "other" {
+		t.Fatal("Versions existing at the time MUST be listed. Found:", len(list))
+	}
+
+	if err := NewVersionQuery().SetAsOf(time.Time{}).Validate(); err == nil {
+		t.Fatal("Zero as of time MUST be rejected")
+	}
+}
+
+func TestStoreVersionAuthorMessageAndMetadata(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_author",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := WithActor(context.Background(), "jane")
+
+	fromContext := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("v1").
+		SetMessage("100% rewrite").
+		SetMeta("source", "api")
+	explicit := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("v2").
+		SetAuthorID("john").
+		SetMessage("fix typo").
+		SetMeta("source", `ui "beta"`).
+		SetMeta("ticket", "42")
+	shouting := NewVersion().SetEntityType("page").SetEntityID("2").SetContent("v1").
+		SetAuthorID("joe").
+		SetMeta("SOURCE", "API").
+		SetMeta(`x"ticket`, "42")
+
+	for _, version := range []VersionInterface{fromContext, explicit, shouting} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if fromContext.AuthorID() != "jane" {
+		t.Fatal("Author MUST be filled from the context. Found:", fromContext.AuthorID())
+	}
+
+	found, err := store.VersionFindByID(ctx, explicit.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.AuthorID() != "john" || found.Message() != "fix typo" || found.Meta("source") != `ui "beta"` || found.Meta("ticket") != "42" {
+		t.Fatal("Author, message and metadata MUST be stored")
+	}
+
+	cases := []struct {
+		name  string
+		query VersionQueryInterface
+		ids   []string
+	}{
+		{"author", NewVersionQuery().SetAuthorID("jane"), []string{fromContext.ID()}},
+		{"message", NewVersionQuery().SetMessageContains("typo"), []string{explicit.ID()}},
+		{"message wildcard", NewVersionQuery().SetMessageContains("0%"), []string{fromContext.ID()}},
+		{"message no match", NewVersionQuery().SetMessageContains("_"), []string{}},
+		{"meta", NewVersionQuery().SetMeta("source", "api"), []string{fromContext.ID()}},
+		{"meta quoted", NewVersionQuery().SetMeta("source", `ui "beta"`), []string{explicit.ID()}},
+		{"metas", NewVersionQuery().SetMeta("source", `ui "beta"`).SetMeta("ticket", "42"), []string{explicit.ID()}},
+		{"meta prefix", NewVersionQuery().SetMeta("ticket", "4"), []string{}},
+		{"meta case", NewVersionQuery().SetMeta("SOURCE", "API"), []string{shouting.ID()}},
+		{"meta quoted key", NewVersionQuery().SetMeta(`x"ticket`, "42"), []string{shouting.ID()}},
+		{"meta key in quoted key", NewVersionQuery().SetMeta("ticket", "42"), []string{explicit.ID()}},
+	}
+
+	for _, c := range cases {
+		list, err := store.VersionList(ctx, c.query)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		ids := []string{}
+		for _, version := range list {
+			ids = append(ids, version.ID())
+		}
+
+		if strings.Join(ids, ",") != strings.Join(c.ids, ",") {
+			t.Fatalf("Filter %s MUST return %v, found %v", c.name, c.ids, ids)
+		}
+	}
+}
+
+func TestStoreVersionDeleteByQuery(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_delete_by_query",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for _, entityID := range []string{"1", "1", "1", "2", "3"} {
+		version := NewVersion().SetEntityType("webpage").SetEntityID(entityID).SetContent("content " + entityID)
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if _, err := store.VersionDeleteByQuery(ctx, NewVersionQuery().SetLimit(1)); !errors.Is(err, ErrUnfilteredQuery) {
+		t.Fatal("Delete by a query without filters MUST fail with ErrUnfilteredQuery. Found:", err)
+	}
+	if _, err := store.VersionSoftDeleteByQuery(ctx, NewVersionQuery().SetSoftDeletedIncluded(true)); !errors.Is(err, ErrUnfilteredQuery) {
+		t.Fatal("Soft delete by a query without filters MUST fail with ErrUnfilteredQuery. Found:", err)
+	}
+
+	for _, query := range []VersionQueryInterface{
+		NewVersionQuery().SetAsOf(time.Now()),
+		NewVersionQuery().SetVersionNumberGreaterThan(0),
+		NewVersionQuery().SetVersionNumberLessThan(100),
+		NewVersionQuery().SetMessageContains("a"),
+	} {
+		if _, err := store.VersionSoftDeleteByQuery(ctx, query); !errors.Is(err, ErrUnfilteredQuery) {
+			t.Fatal("Delete by a query filtering only by range or message MUST fail with ErrUnfilteredQuery. Found:", err)
+		}
+	}
+
+	softDeleted, err := store.VersionSoftDeleteByQuery(ctx, NewVersionQuery().SetEntityID("1").SetVersionNumberGreaterThan(1))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if softDeleted != 2 {
+		t.Fatal("Soft delete by query MUST return the versions soft deleted. Found:", softDeleted)
+	}
+
+	softDeleted, err = store.VersionSoftDeleteByQuery(ctx, NewVersionQuery().SetEntityID("1").SetSoftDeletedIncluded(true),
+		VersionDeleteByQueryOptions{VersionBatchOptions: VersionBatchOptions{ChunkSize: 1}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if softDeleted != 1 {
+		t.Fatal("Soft delete by query MUST skip versions already soft deleted. Found:", softDeleted)
+	}
+
+	deleted, err := store.VersionDeleteByQuery(ctx, NewVersionQuery().SetEntityID("1").SetSoftDeletedOnly(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if deleted != 3 {
+		t.Fatal("Delete by query MUST return the versions deleted. Found:", deleted)
+	}
+
+	deleted, err = store.VersionDeleteByQuery(ctx, NewVersionQuery(), VersionDeleteByQueryOptions{Force: true, VersionBatchOptions: VersionBatchOptions{ChunkSize: 1}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if deleted != 2 {
+		t.Fatal("Forced delete by a query without filters MUST delete every version. Found:", deleted)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetSoftDeletedIncluded(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 0 {
+		t.Fatal("Deleted versions MUST be removed. Found:", len(list))
+	}
+}
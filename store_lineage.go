@@ -0,0 +1,96 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// VersionAncestors returns the versions the given version descends from,
+// nearest first. Soft deleted ancestors are left out of the result but do
+// not break the chain.
+func (store *storeImplementation) VersionAncestors(ctx context.Context, versionID string) ([]VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if versionID == "" {
+		return nil, errors.New("version store: version id is required")
+	}
+
+	// parents lists both parent links of every version, so the walk follows
+	// merges into the branch they came from
+	parents := `SELECT ` + COLUMN_ID + ` AS child_id, ` + COLUMN_PARENT_ID + ` AS parent_id FROM ` + store.tableName +
+		` WHERE ` + COLUMN_PARENT_ID + ` <> ''` +
+		` UNION ALL` +
+		` SELECT ` + COLUMN_ID + `, ` + COLUMN_MERGE_PARENT_ID + ` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_MERGE_PARENT_ID + ` <> ''`
+
+	sqlStr := `WITH RECURSIVE parents AS (` + parents + `),` +
+		` ancestors (id, depth) AS (` +
+		`SELECT parent_id, 1 FROM parents WHERE child_id = ?` +
+		` UNION` +
+		` SELECT p.parent_id, a.depth + 1 FROM parents p` +
+		` JOIN ancestors a ON p.child_id = a.id` +
+		`)` +
+		` SELECT v.* FROM ` + store.tableName + ` v` +
+		` JOIN (SELECT id, MIN(depth) AS depth FROM ancestors GROUP BY id) a ON v.` + COLUMN_ID + ` = a.id` +
+		` WHERE v.` + COLUMN_SOFT_DELETED_AT + ` > ?` +
+		` ORDER BY a.depth, v.` + COLUMN_VERSION_NUMBER + ` DESC`
+
+	return store.queryVersions(ctx, sqlStr, versionID, toDateTimeString(carbon.Now(carbon.UTC)))
+}
+
+// VersionBranches returns the names of the branches of an entity that have
+// non soft deleted versions, sorted by name
+func (store *storeImplementation) VersionBranches(ctx context.Context, entityType string, entityID string) ([]string, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+
+	sqlStr := `SELECT DISTINCT ` + COLUMN_BRANCH + ` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_ENTITY_TYPE + ` = ? AND ` + COLUMN_ENTITY_ID + ` = ?` +
+		` AND ` + COLUMN_SOFT_DELETED_AT + ` > ?` +
+		` ORDER BY ` + COLUMN_BRANCH
+
+	rows, err := store.query(ctx, sqlStr, entityType, entityID, toDateTimeString(carbon.Now(carbon.UTC)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := []string{}
+	for rows.Next() {
+		var branch string
+		if err := rows.Scan(&branch); err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch)
+	}
+
+	return branches, rows.Err()
+}
+
+// VersionChildren returns the non soft deleted versions derived directly
+// from the given version, including merges it was merged into, oldest first
+func (store *storeImplementation) VersionChildren(ctx context.Context, versionID string) ([]VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if versionID == "" {
+		return nil, errors.New("version store: version id is required")
+	}
+
+	sqlStr := `SELECT * FROM ` + store.tableName +
+		` WHERE (` + COLUMN_PARENT_ID + ` = ? OR ` + COLUMN_MERGE_PARENT_ID + ` = ?)` +
+		` AND ` + COLUMN_SOFT_DELETED_AT + ` > ?` +
+		` ORDER BY ` + COLUMN_VERSION_NUMBER
+
+	return store.queryVersions(ctx, sqlStr, versionID, versionID, toDateTimeString(carbon.Now(carbon.UTC)))
+}
@@ -0,0 +1,139 @@
+package versionstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStoreVersionLineage(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_lineage",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(version VersionInterface) VersionInterface {
+		if err := store.VersionCreate(ctx, version.SetEntityType("webpage").SetEntityID("1")); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	v1 := create(NewVersion().SetContent("v1"))
+	v2 := create(NewVersion().SetContent("v2"))
+	draft1 := create(NewVersion().SetContent("draft1").SetBranch("draft").SetParentID(v2.ID()))
+	v3 := create(NewVersion().SetContent("v3"))
+	draft2 := create(NewVersion().SetContent("draft2").SetBranch("draft"))
+
+	if v1.ParentID() != "" {
+		t.Fatal("First version MUST NOT have a parent. Found:", v1.ParentID())
+	}
+
+	if v1.Branch() != DEFAULT_BRANCH {
+		t.Fatal("Branch MUST default to", DEFAULT_BRANCH, "Found:", v1.Branch())
+	}
+
+	if v3.ParentID() != v2.ID() {
+		t.Fatal("Version MUST continue the main branch")
+	}
+
+	if draft2.ParentID() != draft1.ID() {
+		t.Fatal("Version MUST continue the draft branch")
+	}
+
+	ancestors, err := store.VersionAncestors(ctx, draft2.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ids := []string{}
+	for _, ancestor := range ancestors {
+		ids = append(ids, ancestor.Content())
+	}
+
+	if strings.Join(ids, ",") != "draft1,v2,v1" {
+		t.Fatal("Ancestors MUST be draft1,v2,v1. Found:", strings.Join(ids, ","))
+	}
+
+	children, err := store.VersionChildren(ctx, v2.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(children) != 2 || children[0].ID() != draft1.ID() || children[1].ID() != v3.ID() {
+		t.Fatal("Children of v2 MUST be draft1 and v3")
+	}
+
+	branches, err := store.VersionBranches(ctx, "webpage", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if strings.Join(branches, ",") != "draft,main" {
+		t.Fatal("Branches MUST be draft,main. Found:", strings.Join(branches, ","))
+	}
+
+	// a soft deleted ancestor is skipped without breaking the chain
+	if err := store.VersionSoftDelete(ctx, v2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ancestors, err = store.VersionAncestors(ctx, v3.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(ancestors) != 1 || ancestors[0].ID() != v1.ID() {
+		t.Fatal("Ancestors of v3 MUST be v1 once v2 is soft deleted")
+	}
+}
+
+func TestStoreVersionCreate_ParentOfAnotherEntity(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_parent_another_entity",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	other := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetContent("other")
+
+	if err := store.VersionCreate(ctx, other); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	version := NewVersion().
+		SetEntityType("webpage").
+		SetEntityID("2").
+		SetParentID(other.ID()).
+		SetContent("content")
+
+	if err := store.VersionCreate(ctx, version); err == nil {
+		t.Fatal("Error MUST NOT be nil for a parent of another entity")
+	}
+
+	version.SetParentID("missing")
+
+	if err := store.VersionCreate(ctx, version); err == nil {
+		t.Fatal("Error MUST NOT be nil for a missing parent")
+	}
+}
@@ -0,0 +1,49 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+)
+
+// Merge merges theirs into ours, both derived from base, and stores the
+// result as a new version on the branch of ours. The new version has ours as
+// its parent and theirs as its merge parent, so the history shows both.
+//
+// If the changes cannot be merged automatically no version is created and a
+// *MergeConflictError listing the conflicts is returned.
+func (store *storeImplementation) Merge(ctx context.Context, base VersionInterface, ours VersionInterface, theirs VersionInterface, strategy MergeStrategy) (VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if base == nil || ours == nil || theirs == nil {
+		return nil, errors.New("version store: base, ours and theirs versions are required")
+	}
+
+	for _, side := range []VersionInterface{base, theirs} {
+		if side.EntityType() != ours.EntityType() || side.EntityID() != ours.EntityID() {
+			return nil, errors.New("version store: merged versions must belong to the same entity")
+		}
+	}
+
+	content, conflicts, err := mergeContent(base.Content(), ours.Content(), theirs.Content(), strategy)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, &MergeConflictError{Conflicts: conflicts}
+	}
+
+	merged := NewVersion().
+		SetEntityType(ours.EntityType()).
+		SetEntityID(ours.EntityID()).
+		SetBranch(ours.Branch()).
+		SetParentID(ours.ID()).
+		SetMergeParentID(theirs.ID()).
+		SetContent(content)
+
+	if err := store.VersionCreate(ctx, merged); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,128 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStoreMerge(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_merge",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(version VersionInterface) VersionInterface {
+		if err := store.VersionCreate(ctx, version.SetEntityType("webpage").SetEntityID("1")); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	base := create(NewVersion().SetContent("title\nintro\nbody"))
+	ours := create(NewVersion().SetContent("title\nintro\nbody changed"))
+	theirs := create(NewVersion().SetContent("title changed\nintro\nbody").SetBranch("draft").SetParentID(base.ID()))
+
+	merged, err := store.Merge(ctx, base, ours, theirs, MERGE_STRATEGY_TEXT)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if merged.Content() != "title changed\nintro\nbody changed" {
+		t.Fatal("Merged content MUST combine both sides. Found:", merged.Content())
+	}
+
+	if merged.ParentID() != ours.ID() || merged.MergeParentID() != theirs.ID() {
+		t.Fatal("Merged version MUST reference both parents")
+	}
+
+	if merged.Branch() != DEFAULT_BRANCH {
+		t.Fatal("Merged version MUST be on the branch of ours. Found:", merged.Branch())
+	}
+
+	mergedFound, err := store.VersionFindByID(ctx, merged.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if mergedFound == nil || mergedFound.MergeParentID() != theirs.ID() {
+		t.Fatal("Merge parent MUST be stored")
+	}
+
+	ancestors, err := store.VersionAncestors(ctx, merged.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(ancestors) != 3 {
+		t.Fatal("Ancestors MUST include both sides and the base. Found:", len(ancestors))
+	}
+
+	children, err := store.VersionChildren(ctx, theirs.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(children) != 1 || children[0].ID() != merged.ID() {
+		t.Fatal("Merged version MUST be a child of theirs")
+	}
+}
+
+func TestStoreMerge_Conflict(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_merge_conflict",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(version VersionInterface) VersionInterface {
+		if err := store.VersionCreate(ctx, version.SetEntityType("webpage").SetEntityID("1")); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	base := create(NewVersion().SetContent(`{"title":"Home"}`))
+	ours := create(NewVersion().SetContent(`{"title":"Our home"}`))
+	theirs := create(NewVersion().SetContent(`{"title":"Their home"}`).SetBranch("draft").SetParentID(base.ID()))
+
+	merged, err := store.Merge(ctx, base, ours, theirs, MERGE_STRATEGY_JSON)
+	if !errors.Is(err, ErrMergeConflict) {
+		t.Fatal("Merge MUST fail with ErrMergeConflict. Found:", err)
+	}
+
+	if merged != nil {
+		t.Fatal("Merge with conflicts MUST NOT create a version")
+	}
+
+	var conflictErr *MergeConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0].Path != "title" {
+		t.Fatal("Conflict MUST be reported for title")
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("webpage").SetEntityID("1"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 3 {
+		t.Fatal("Merge with conflicts MUST NOT store a version. Found:", len(list))
+	}
+}
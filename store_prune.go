@@ -0,0 +1,287 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// PruneReport describes the versions removed by Prune, or that would be
+// removed on a dry run
+type PruneReport struct {
+	DryRun     bool
+	HardDelete bool
+
+	// EntitiesScanned and VersionsScanned count the non soft deleted
+	// entities and versions the policy was applied to
+	EntitiesScanned int
+	VersionsScanned int
+
+	// Removed lists the removed versions, without their content
+	Removed []VersionInterface
+
+	// RemovedByEntityType counts the removed versions per entity type
+	RemovedByEntityType map[string]int
+}
+
+// Prune applies a retention policy to every entity, soft deleting or, if
+// the policy says so, hard deleting the versions it does not keep. Soft
+// deleted versions are left alone. On a dry run nothing is deleted and the
+// report lists what would be. Entities under legal hold are skipped: the
+// others are pruned and the report returned along with a *LegalHoldError
+// listing the holds that prevented pruning.
+func (store *storeImplementation) Prune(ctx context.Context, policy RetentionPolicy, dryRun bool) (*PruneReport, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := carbon.Now(carbon.UTC)
+
+	holds, err := store.queryHolds(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	holdsByEntity := map[[2]string][]Hold{}
+	for _, hold := range holds {
+		key := [2]string{hold.EntityType, hold.EntityID}
+		holdsByEntity[key] = append(holdsByEntity[key], hold)
+	}
+
+	held := []Hold{}
+
+	report := &PruneReport{
+		DryRun:              dryRun,
+		HardDelete:          policy.HardDelete,
+		Removed:             []VersionInterface{},
+		RemovedByEntityType: map[string]int{},
+	}
+
+	batchSize := policy.BatchSize
+	if batchSize == 0 {
+		batchSize = DEFAULT_PRUNE_BATCH_SIZE
+	}
+
+	// each deleted version binds its id twice, so a statement deletes no
+	// more versions than the parameter budget allows
+	deleteSize := min(batchSize, batchChunkSize(nil, batchDeleteParameters))
+
+	// the entities are read batchSize at a time, in order, each page being
+	// pruned before the next is read
+	after := [2]string{}
+	for {
+		entities, err := store.pruneEntities(ctx, after, toDateTimeString(now), batchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(entities) == 0 {
+			break
+		}
+		after = entities[len(entities)-1]
+
+		versions, err := store.pruneVersions(ctx, entities, toDateTimeString(now))
+		if err != nil {
+			return nil, err
+		}
+
+		report.VersionsScanned += len(versions)
+
+		removed := []VersionInterface{}
+		for start := 0; start < len(versions); {
+			end := start + 1
+			for end < len(versions) &&
+				versions[end].EntityType() == versions[start].EntityType() &&
+				versions[end].EntityID() == versions[start].EntityID() {
+				end++
+			}
+
+			entityType := versions[start].EntityType()
+			expired := policy.rulesFor(entityType).expired(versions[start:end], now.StdTime())
+
+			report.EntitiesScanned++
+
+			if entityHolds, ok := holdsByEntity[[2]string{entityType, versions[start].EntityID()}]; ok && len(expired) > 0 {
+				held = append(held, entityHolds...)
+				expired = nil
+			}
+
+			removed = append(removed, expired...)
+			if len(expired) > 0 {
+				report.RemovedByEntityType[entityType] += len(expired)
+			}
+
+			start = end
+		}
+
+		report.Removed = append(report.Removed, removed...)
+
+		if dryRun {
+			continue
+		}
+
+		for start := 0; start < len(removed); start += deleteSize {
+			ids := []string{}
+			for _, version := range removed[start:min(start+deleteSize, len(removed))] {
+				ids = append(ids, version.ID())
+			}
+
+			if err := store.versionDeleteBatch(ctx, ids, policy.HardDelete); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(held) > 0 {
+		return report, &LegalHoldError{Holds: held}
+	}
+
+	return report, nil
+}
+
+// pruneEntities returns up to limit entities with non soft deleted
+// versions, ordered by entity type and id, after the given entity
+func (store *storeImplementation) pruneEntities(ctx context.Context, after [2]string, now string, limit int) ([][2]string, error) {
+	rows, err := store.query(ctx, `SELECT DISTINCT `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+
+		` FROM `+store.tableName+
+		` WHERE `+COLUMN_SOFT_DELETED_AT+` > ?`+
+		` AND (`+COLUMN_ENTITY_TYPE+` > ? OR (`+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` > ?))`+
+		` ORDER BY `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+
+		` LIMIT ?`, now, after[0], after[0], after[1], limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entities := [][2]string{}
+	for rows.Next() {
+		var entity [2]string
+		if err := rows.Scan(&entity[0], &entity[1]); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, rows.Err()
+}
+
+// pruneVersions returns the non soft deleted versions of the entities,
+// without their content, each entity's newest first. The entities are
+// queried as many at a time as the parameter budget allows, each binding
+// its type and id.
+func (store *storeImplementation) pruneVersions(ctx context.Context, entities [][2]string, now string) ([]VersionInterface, error) {
+	chunkSize := max(1, (DEFAULT_BATCH_MAX_PARAMETERS-1)/2)
+
+	versions := []VersionInterface{}
+	for start := 0; start < len(entities); start += chunkSize {
+		chunk, err := store.pruneVersionsChunk(ctx, entities[start:min(start+chunkSize, len(entities))], now)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, chunk...)
+	}
+
+	return versions, nil
+}
+
+// pruneVersionsChunk returns the non soft deleted versions of the entities
+// in a single statement
+func (store *storeImplementation) pruneVersionsChunk(ctx context.Context, entities [][2]string, now string) ([]VersionInterface, error) {
+	conditions := []string{}
+	args := []any{now}
+	for _, entity := range entities {
+		conditions = append(conditions, `(`+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?)`)
+		args = append(args, entity[0], entity[1])
+	}
+
+	rows, err := store.query(ctx, `SELECT `+strings.Join([]string{COLUMN_ID, COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID, COLUMN_VERSION_NUMBER, COLUMN_CREATED_AT}, ", ")+
+		` FROM `+store.tableName+
+		` WHERE `+COLUMN_SOFT_DELETED_AT+` > ?`+
+		` AND (`+strings.Join(conditions, " OR ")+`)`+
+		` ORDER BY `+COLUMN_ENTITY_TYPE+`, `+COLUMN_ENTITY_ID+`, `+COLUMN_VERSION_NUMBER+` DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanVersions(rows)
+}
+
+// PurgeSoftDeleted permanently deletes the versions soft deleted more than
+// olderThan ago. The versions are deleted batchSize at a time, each batch in
+// its own statement, so that a busy database is never locked for long. The
+// batch size is capped to what a statement can bind, DEFAULT_BATCH_MAX_PARAMETERS
+// parameters with each version binding its id twice. It
+// returns the number of versions deleted per entity type. Versions of
+// entities under legal hold are kept, and a *LegalHoldError listing the
+// holds is returned once the others are purged.
+func (store *storeImplementation) PurgeSoftDeleted(ctx context.Context, olderThan time.Duration, batchSize int) (map[string]int64, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if olderThan < 0 {
+		return nil, errors.New("version store: grace period cannot be negative")
+	}
+	if batchSize < 0 {
+		return nil, errors.New("version store: batch size cannot be negative")
+	}
+	if batchSize == 0 {
+		batchSize = DEFAULT_PRUNE_BATCH_SIZE
+	}
+	batchSize = min(batchSize, batchChunkSize(nil, batchDeleteParameters))
+
+	cutoff := toDateTimeString(carbon.CreateFromStdTime(time.Now().Add(-olderThan)))
+
+	sqlStr := `SELECT ` + COLUMN_ID + `, ` + COLUMN_ENTITY_TYPE + ` FROM ` + store.tableName +
+		` WHERE ` + COLUMN_SOFT_DELETED_AT + ` <= ?` +
+		` AND ` + store.holdNotExistsSQL() +
+		` ORDER BY ` + COLUMN_SOFT_DELETED_AT +
+		` LIMIT ?`
+
+	purged := map[string]int64{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		versions, err := store.queryVersions(ctx, sqlStr, cutoff, batchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		ids := []string{}
+		for _, version := range versions {
+			ids = append(ids, version.ID())
+		}
+
+		if err := store.versionDeleteBatch(ctx, ids, true); err != nil {
+			return purged, err
+		}
+
+		for _, version := range versions {
+			purged[version.EntityType()]++
+		}
+
+		if len(versions) < batchSize {
+			break
+		}
+	}
+
+	holds, err := store.queryHolds(ctx, ` WHERE EXISTS (SELECT 1 FROM `+store.tableName+
+		` WHERE `+store.tableName+`.`+COLUMN_SOFT_DELETED_AT+` <= ?`+
+		` AND `+store.tableName+`.`+COLUMN_ENTITY_TYPE+` = `+store.holdTableName()+`.`+COLUMN_ENTITY_TYPE+
+		` AND `+store.tableName+`.`+COLUMN_ENTITY_ID+` = `+store.holdTableName()+`.`+COLUMN_ENTITY_ID+`)`, cutoff)
+	if err != nil {
+		return purged, err
+	}
+	if len(holds) > 0 {
+		return purged, &LegalHoldError{Holds: holds}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,281 @@
+package versionstore
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStorePrune(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_prune",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for _, entityType := range []string{"page", "post"} {
+		for i := 0; i < 5; i++ {
+			version := NewVersion().SetEntityType(entityType).SetEntityID("1").SetContent("content")
+			if err := store.VersionCreate(ctx, version); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+		}
+	}
+
+	policy := RetentionPolicy{
+		RetentionRules: RetentionRules{KeepLast: 2},
+		EntityTypeRules: map[string]RetentionRules{
+			"post": {KeepLast: 4},
+		},
+		BatchSize: 2,
+	}
+
+	count := func(entityType string) int {
+		list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType(entityType))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return len(list)
+	}
+
+	report, err := store.Prune(ctx, policy, true)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !report.DryRun || len(report.Removed) != 4 {
+		t.Fatal("Dry run MUST report 4 versions. Found:", len(report.Removed))
+	}
+
+	if report.RemovedByEntityType["page"] != 3 || report.RemovedByEntityType["post"] != 1 {
+		t.Fatal("Dry run MUST apply the entity type overrides. Found:", report.RemovedByEntityType)
+	}
+
+	if report.EntitiesScanned != 2 || report.VersionsScanned != 10 {
+		t.Fatal("Dry run MUST scan 2 entities and 10 versions")
+	}
+
+	if count("page") != 5 || count("post") != 5 {
+		t.Fatal("Dry run MUST NOT delete versions")
+	}
+
+	report, err = store.Prune(ctx, policy, false)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(report.Removed) != 4 {
+		t.Fatal("Prune MUST remove 4 versions. Found:", len(report.Removed))
+	}
+
+	if count("page") != 2 || count("post") != 4 {
+		t.Fatal("Prune MUST keep the versions of the policy")
+	}
+
+	latest, err := store.VersionLatest(ctx, "page", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if latest == nil || latest.VersionNumber() != 5 {
+		t.Fatal("Prune MUST keep the latest version")
+	}
+
+	trash, err := store.VersionList(ctx, NewVersionQuery().SetSoftDeletedOnly(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(trash) != 4 {
+		t.Fatal("Prune MUST soft delete by default. Found:", len(trash))
+	}
+
+	policy.HardDelete = true
+	policy.RetentionRules = RetentionRules{KeepLast: 1}
+
+	report, err = store.Prune(ctx, policy, false)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !report.HardDelete || len(report.Removed) != 1 {
+		t.Fatal("Prune MUST hard delete 1 version. Found:", len(report.Removed))
+	}
+
+	all, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("page").SetSoftDeletedIncluded(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(all) != 4 {
+		t.Fatal("Prune MUST hard delete the excess version. Found:", len(all))
+	}
+
+	if _, err := store.Prune(ctx, RetentionPolicy{}, true); err == nil {
+		t.Fatal("Prune with an empty policy MUST fail")
+	}
+}
+
+func TestStorePrune_Pages(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_prune_pages",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	for _, entityID := range []string{"1", "2", "3", "4", "5"} {
+		for i := 0; i < 3; i++ {
+			version := NewVersion().SetEntityType("page").SetEntityID(entityID).SetContent("content")
+			if err := store.VersionCreate(ctx, version); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+		}
+	}
+
+	report, err := store.Prune(ctx, RetentionPolicy{RetentionRules: RetentionRules{KeepLast: 1}, BatchSize: 2}, false)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if report.EntitiesScanned != 5 || report.VersionsScanned != 15 || len(report.Removed) != 10 {
+		t.Fatal("Prune MUST page through every entity. Found:", report.EntitiesScanned, report.VersionsScanned, len(report.Removed))
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("page"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 5 {
+		t.Fatal("Prune MUST keep the latest version of every entity. Found:", len(list))
+	}
+}
+
+func TestStorePrune_LargeBatch(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_prune_large",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	versions := []VersionInterface{}
+	for i := 0; i < 2; i++ {
+		for entityID := 0; entityID < 600; entityID++ {
+			versions = append(versions, NewVersion().SetEntityType("page").SetEntityID(strconv.Itoa(entityID)).SetContent("content "+strconv.Itoa(i)))
+		}
+	}
+	if err := store.VersionCreateMany(ctx, versions); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// a page of 600 entities and 600 deletes is split to fit the
+	// parameter budget
+	report, err := store.Prune(ctx, RetentionPolicy{RetentionRules: RetentionRules{KeepLast: 1}, HardDelete: true, BatchSize: 1000}, false)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if report.EntitiesScanned != 600 || report.VersionsScanned != 1200 || len(report.Removed) != 600 {
+		t.Fatal("Prune MUST scan every entity of a large page. Found:", report.EntitiesScanned, report.VersionsScanned, len(report.Removed))
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("page").SetSoftDeletedIncluded(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 600 {
+		t.Fatal("Prune MUST hard delete every excess version. Found:", len(list))
+	}
+}
+
+func TestStorePurgeSoftDeleted(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_purge_soft_deleted",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(entityType string, softDeletedAt time.Time) VersionInterface {
+		version := NewVersion().SetEntityType(entityType).SetEntityID("1").SetContent("content")
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if !softDeletedAt.IsZero() {
+			if err := store.VersionExpireAt(ctx, version.ID(), softDeletedAt); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+		}
+		return version
+	}
+
+	twoDaysAgo := time.Now().Add(-48 * time.Hour)
+	anHourAgo := time.Now().Add(-time.Hour)
+
+	create("page", twoDaysAgo)
+	create("page", twoDaysAgo)
+	create("post", twoDaysAgo)
+	recent := create("post", anHourAgo)
+	live := create("post", time.Time{})
+
+	purged, err := store.PurgeSoftDeleted(ctx, 24*time.Hour, 1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(purged) != 2 || purged["page"] != 2 || purged["post"] != 1 {
+		t.Fatal("Purge MUST delete 2 pages and 1 post. Found:", purged)
+	}
+
+	all, err := store.VersionList(ctx, NewVersionQuery().SetSoftDeletedIncluded(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(all) != 2 {
+		t.Fatal("Purge MUST keep the recently soft deleted and live versions. Found:", len(all))
+	}
+
+	for _, version := range all {
+		if version.ID() != recent.ID() && version.ID() != live.ID() {
+			t.Fatal("Purge MUST keep the recently soft deleted and live versions")
+		}
+	}
+
+	if _, err := store.PurgeSoftDeleted(ctx, -time.Hour, 1); err == nil {
+		t.Fatal("Purge with a negative grace period MUST fail")
+	}
+}
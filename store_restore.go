@@ -0,0 +1,154 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// VersionRestoreOptions define the options for restoring a version
+type VersionRestoreOptions struct {
+	// SoftDeleteIntermediate soft deletes the versions created on the
+	// restored version's branch after it, so that the new head continues
+	// directly from the restored version
+	SoftDeleteIntermediate bool
+}
+
+// VersionRestore rolls an entity back to a previous version by creating a
+// new head version on the same branch with the content of the given version.
+// The new version records the restored version in RestoredFrom. Every change
+// is made in a single transaction.
+func (store *storeImplementation) VersionRestore(ctx context.Context, versionID string, opts VersionRestoreOptions) (VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if versionID == "" {
+		return nil, errors.New("version store: version id is required")
+	}
+
+	var restored VersionInterface
+
+	err := store.transaction(ctx, func(txStore *storeImplementation) error {
+		target, err := txStore.VersionFindByID(ctx, versionID)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			return errors.New("version store: version not found")
+		}
+
+		if opts.SoftDeleteIntermediate {
+			if err := txStore.versionSoftDeleteAfter(ctx, target); err != nil {
+				return err
+			}
+		}
+
+		version := NewVersion().
+			SetEntityType(target.EntityType()).
+			SetEntityID(target.EntityID()).
+			SetBranch(target.Branch()).
+			SetRestoredFrom(target.ID()).
+			SetContent(target.Content())
+
+		if err := txStore.VersionCreate(ctx, version); err != nil {
+			return err
+		}
+
+		restored = version
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// versionSoftDeleteAfter soft deletes the non soft deleted versions created
+// on the branch of the given version after it. The holds are checked by the
+// statement itself, so that a hold placed concurrently cannot be missed.
+func (store *storeImplementation) versionSoftDeleteAfter(ctx context.Context, version VersionInterface) error {
+	now := toDateTimeString(carbon.Now(carbon.UTC))
+
+	sqlStr := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_SOFT_DELETED_AT + ` = ?` +
+		` WHERE ` + COLUMN_ENTITY_TYPE + ` = ? AND ` + COLUMN_ENTITY_ID + ` = ?` +
+		` AND ` + COLUMN_BRANCH + ` = ?` +
+		` AND ` + COLUMN_VERSION_NUMBER + ` > ?` +
+		` AND ` + COLUMN_SOFT_DELETED_AT + ` > ?` +
+		` AND ` + store.holdNotExistsSQL()
+
+	result, err := store.exec(ctx, sqlStr, now, version.EntityType(), version.EntityID(), version.Branch(), version.VersionNumber(), now)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// nothing is soft deleted either when no version follows or when the
+	// entity is held
+	if deleted == 0 {
+		return store.holdCheckEntity(ctx, version.EntityType(), version.EntityID())
+	}
+
+	return nil
+}
+
+// VersionRestoreSoftDeleted undeletes a soft deleted version. Restoring a
+// version that is not soft deleted does nothing.
+func (store *storeImplementation) VersionRestoreSoftDeleted(ctx context.Context, versionID string) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+	if versionID == "" {
+		return errors.New("version store: version id is required")
+	}
+
+	version, err := store.versionFindOne(ctx, NewVersionQuery().
+		SetID(versionID).
+		SetSoftDeletedIncluded(true))
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return errors.New("version store: version not found")
+	}
+	if !version.IsSoftDeleted() {
+		return nil
+	}
+
+	version.SetSoftDeletedAt(MAX_DATETIME)
+
+	return store.VersionUpdate(ctx, version)
+}
+
+// VersionRestoreSoftDeletedByEntity undeletes every soft deleted version of
+// an entity and returns the number of versions restored
+func (store *storeImplementation) VersionRestoreSoftDeletedByEntity(ctx context.Context, entityType string, entityID string) (int64, error) {
+	if ctx == nil {
+		return 0, errors.New("ctx is nil")
+	}
+	if entityType == "" {
+		return 0, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return 0, errors.New("version store: entity id is required")
+	}
+
+	sqlStr := `UPDATE ` + store.tableName +
+		` SET ` + COLUMN_SOFT_DELETED_AT + ` = ?` +
+		` WHERE ` + COLUMN_ENTITY_TYPE + ` = ? AND ` + COLUMN_ENTITY_ID + ` = ?` +
+		` AND ` + COLUMN_SOFT_DELETED_AT + ` <= ?`
+
+	result, err := store.exec(ctx, sqlStr, MAX_DATETIME, entityType, entityID, toDateTimeString(carbon.Now(carbon.UTC)))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
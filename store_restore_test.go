@@ -0,0 +1,288 @@
+package versionstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStoreVersionRestore(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_restore",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(content string) VersionInterface {
+		version := NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent(content)
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	v1 := create("v1")
+	create("v2")
+	v3 := create("v3")
+
+	restored, err := store.VersionRestore(ctx, v1.ID(), VersionRestoreOptions{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if restored.Content() != "v1" {
+		t.Fatal("Restored content MUST be v1. Found:", restored.Content())
+	}
+
+	if restored.VersionNumber() != 4 {
+		t.Fatal("Restored version MUST be version 4. Found:", restored.VersionNumber())
+	}
+
+	if restored.ParentID() != v3.ID() {
+		t.Fatal("Restored version MUST continue from the head")
+	}
+
+	latest, err := store.VersionLatest(ctx, "webpage", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if latest == nil || latest.ID() != restored.ID() {
+		t.Fatal("Restored version MUST be the latest version")
+	}
+
+	if latest.RestoredFrom() != v1.ID() {
+		t.Fatal("Restored version MUST record the restored version. Found:", latest.RestoredFrom())
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("webpage").SetEntityID("1"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 4 {
+		t.Fatal("Restore MUST keep the intermediate versions. Found:", len(list))
+	}
+
+	if _, err := store.VersionRestore(ctx, "missing", VersionRestoreOptions{}); err == nil {
+		t.Fatal("Restore of a missing version MUST fail")
+	}
+}
+
+func TestStoreVersionRestore_SoftDeleteIntermediate(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_restore_soft_delete",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(version VersionInterface) VersionInterface {
+		if err := store.VersionCreate(ctx, version.SetEntityType("webpage").SetEntityID("1")); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	v1 := create(NewVersion().SetContent("v1"))
+	v2 := create(NewVersion().SetContent("v2"))
+	draft := create(NewVersion().SetContent("draft").SetBranch("draft"))
+	create(NewVersion().SetContent("v3"))
+
+	restored, err := store.VersionRestore(ctx, v2.ID(), VersionRestoreOptions{SoftDeleteIntermediate: true})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if restored.ParentID() != v2.ID() {
+		t.Fatal("Restored version MUST continue from the restored version")
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ids := []string{}
+	for _, version := range list {
+		ids = append(ids, version.ID())
+	}
+
+	expected := []string{v1.ID(), v2.ID(), draft.ID(), restored.ID()}
+	if len(ids) != len(expected) {
+		t.Fatal("Only the intermediate versions of the branch MUST be soft deleted. Found:", len(ids))
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatal("Only the intermediate versions of the branch MUST be soft deleted")
+		}
+	}
+}
+
+func TestStoreVersionRestore_WithTx(t *testing.T) {
+	db := initTxDB(t)
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_restore_with_tx",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	v1 := NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent("v1")
+	v2 := NewVersion().SetEntityType("webpage").SetEntityID("1").SetContent("v2")
+	for _, version := range []VersionInterface{v1, v2} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	// restoring on its own transaction MUST NOT need a second connection
+	if _, err := store.VersionRestore(ctx, v1.ID(), VersionRestoreOptions{SoftDeleteIntermediate: true}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := store.WithTx(tx).VersionRestore(ctx, v1.ID(), VersionRestoreOptions{SoftDeleteIntermediate: true}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("webpage").SetEntityID("1"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 2 {
+		t.Fatal("Restore MUST be removed by the rollback. Found:", len(list))
+	}
+}
+
+func TestStoreVersionRestoreSoftDeleted(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_restore_soft_deleted",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	create := func(entityID string, content string) VersionInterface {
+		version := NewVersion().SetEntityType("webpage").SetEntityID(entityID).SetContent(content)
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return version
+	}
+
+	v1 := create("1", "v1")
+	v2 := create("1", "v2")
+	v3 := create("1", "v3")
+	other := create("2", "other")
+
+	for _, version := range []VersionInterface{v1, v2, other} {
+		if err := store.VersionSoftDelete(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	trash, err := store.VersionList(ctx, NewVersionQuery().
+		SetEntityType("webpage").
+		SetEntityID("1").
+		SetSoftDeletedOnly(true).
+		SetOrderBy(COLUMN_VERSION_NUMBER).
+		SetSortOrder("asc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(trash) != 2 || trash[0].ID() != v1.ID() || trash[1].ID() != v2.ID() {
+		t.Fatal("Trash MUST list only the soft deleted versions. Found:", len(trash))
+	}
+
+	if err := store.VersionRestoreSoftDeleted(ctx, v1.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.VersionFindByID(ctx, v1.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.IsSoftDeleted() {
+		t.Fatal("Version MUST be restored")
+	}
+
+	if err := store.VersionRestoreSoftDeleted(ctx, v3.ID()); err != nil {
+		t.Fatal("Restoring a live version MUST do nothing. Found:", err)
+	}
+
+	if err := store.VersionRestoreSoftDeleted(ctx, "missing"); err == nil {
+		t.Fatal("Restoring a missing version MUST fail")
+	}
+
+	count, err := store.VersionRestoreSoftDeletedByEntity(ctx, "webpage", "1")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("Restore by entity MUST restore 1 version. Found:", count)
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().SetEntityType("webpage").SetEntityID("1"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 3 {
+		t.Fatal("Every version of the entity MUST be live. Found:", len(list))
+	}
+
+	trash, err = store.VersionList(ctx, NewVersionQuery().SetSoftDeletedOnly(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(trash) != 1 || trash[0].ID() != other.ID() {
+		t.Fatal("Versions of other entities MUST stay soft deleted")
+	}
+}
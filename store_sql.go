@@ -0,0 +1,463 @@
+package versionstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	contractsdatabase "github.com/dracory/neat/contracts/database"
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	"github.com/dracory/neat/database/driver"
+	"github.com/dracory/neat/database/query"
+	"github.com/dracory/neat/database/schema"
+	"github.com/dracory/neat/database/schema/grammars"
+	"github.com/dromara/carbon/v2"
+)
+
+// sqlExecutor is the subset of *sql.DB and *sql.Tx used by the store, so that
+// every statement can run either on the database or on a caller's transaction.
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var _ sqlExecutor = (*sql.DB)(nil)
+var _ sqlExecutor = (*sql.Tx)(nil)
+
+// == TRANSACTIONS ============================================================
+
+// WithTx returns a copy of the store that runs every statement, including
+// migrations, on the given transaction. Committing or rolling back the
+// transaction is left to the caller.
+func (store *storeImplementation) WithTx(tx *sql.Tx) StoreInterface {
+	if tx == nil {
+		return store
+	}
+
+	txStore := *store
+	txStore.tx = tx
+	return &txStore
+}
+
+// transaction runs fn on a copy of the store bound to a transaction, so
+// that its statements succeed or fail together. On a store already bound to
+// a caller's transaction fn runs on that transaction and committing is left
+// to the caller; otherwise a transaction is begun, then committed if fn
+// succeeds and rolled back if it fails.
+func (store *storeImplementation) transaction(ctx context.Context, fn func(txStore *storeImplementation) error) error {
+	if store.tx != nil {
+		return fn(store)
+	}
+
+	tx, err := store.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txStore := *store
+	txStore.tx = tx
+
+	if err := fn(&txStore); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && store.debugEnabled {
+			store.logger.Error("transaction rollback failed", "error", rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// executor returns the caller's transaction if one is attached,
+// otherwise the database
+func (store *storeImplementation) executor() sqlExecutor {
+	if store.tx != nil {
+		return store.tx
+	}
+	return store.sqlDB
+}
+
+// exec executes a statement that returns no rows
+func (store *storeImplementation) exec(ctx context.Context, sqlStr string, args ...any) (sql.Result, error) {
+	sqlStr = store.rebind(sqlStr)
+	store.logSQL(sqlStr, args)
+	return store.executor().ExecContext(ctx, sqlStr, args...)
+}
+
+// query executes a statement that returns rows
+func (store *storeImplementation) query(ctx context.Context, sqlStr string, args ...any) (*sql.Rows, error) {
+	sqlStr = store.rebind(sqlStr)
+	store.logSQL(sqlStr, args)
+	return store.executor().QueryContext(ctx, sqlStr, args...)
+}
+
+// queryRow executes a statement that returns at most one row
+func (store *storeImplementation) queryRow(ctx context.Context, sqlStr string, args ...any) *sql.Row {
+	sqlStr = store.rebind(sqlStr)
+	store.logSQL(sqlStr, args)
+	return store.executor().QueryRowContext(ctx, sqlStr, args...)
+}
+
+// logSQL logs the statement when debug is enabled
+func (store *storeImplementation) logSQL(sqlStr string, args []any) {
+	if store.debugEnabled {
+		store.logger.Info("SQL", "sql", sqlStr, "args", args)
+	}
+}
+
+// == DIALECT =================================================================
+
+// dialect returns the name of the database driver (sqlite, mysql, postgres, ...)
+func (store *storeImplementation) dialect() contractsdatabase.Driver {
+	return store.db.Query().Driver()
+}
+
+// rebind replaces the ? placeholders of a hand written statement with the
+// placeholders of the database dialect
+func (store *storeImplementation) rebind(sqlStr string) string {
+	placeholder := driver.GetPlaceholderFunc(string(store.dialect()))
+	if placeholder(1) == "?" {
+		return sqlStr
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, r := range sqlStr {
+		if r == '?' {
+			n++
+			sb.WriteString(placeholder(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// metadataConditionSQL returns a condition matching the versions whose
+// metadata has the key with the value, and its arguments. The metadata is
+// read with the JSON functions of the database, so that the key and the
+// value are compared exactly, case included. Versions without metadata
+// store it empty, read as an empty object.
+func (store *storeImplementation) metadataConditionSQL(key string, value string) (string, []any) {
+	metadata := `COALESCE(NULLIF(` + COLUMN_METADATA + `, ''), '{}')`
+
+	// the JSON path of the key, quoted so that any key is a single member
+	quoted, _ := json.Marshal(key)
+	path := `$.` + string(quoted)
+
+	switch store.dialect() {
+	case contractsdatabase.DriverPostgres:
+		return `(` + metadata + `)::jsonb ->> ? = ?`, []any{key, value}
+	case contractsdatabase.DriverMysql:
+		return `JSON_UNQUOTE(JSON_EXTRACT(` + metadata + `, ?)) = ?`, []any{path, value}
+	case contractsdatabase.DriverSqlserver:
+		return `JSON_VALUE(` + metadata + `, ?) = ?`, []any{path, value}
+	case contractsdatabase.DriverOracle:
+		// Oracle takes the path as a literal only
+		return `JSON_VALUE(` + metadata + `, '` + strings.ReplaceAll(path, "'", "''") + `') = ?`, []any{value}
+	default:
+		return `EXISTS (SELECT 1 FROM json_each(` + metadata + `) WHERE json_each.key = ? AND json_each.value = ?)`, []any{key, value}
+	}
+}
+
+// grammar returns the schema grammar of the database dialect
+func (store *storeImplementation) grammar() contractsschema.Grammar {
+	switch store.dialect() {
+	case contractsdatabase.DriverMysql:
+		return grammars.NewMysql("")
+	case contractsdatabase.DriverPostgres:
+		return grammars.NewPostgres("")
+	case contractsdatabase.DriverSqlserver:
+		return grammars.NewSqlserver("")
+	case contractsdatabase.DriverOracle:
+		return grammars.NewOracle("")
+	default:
+		return grammars.NewSqlite(nil, "")
+	}
+}
+
+// == SCHEMA ==================================================================
+
+// schemaCreate creates a table from the blueprint built by the callback
+func (store *storeImplementation) schemaCreate(ctx context.Context, tableName string, callback func(table contractsschema.Blueprint)) error {
+	blueprint := schema.NewBlueprint(store.db.Schema(), "", tableName)
+	blueprint.Create()
+	callback(blueprint)
+	return store.schemaBuild(ctx, blueprint)
+}
+
+// schemaTable alters a table with the blueprint built by the callback
+func (store *storeImplementation) schemaTable(ctx context.Context, tableName string, callback func(table contractsschema.Blueprint)) error {
+	blueprint := schema.NewBlueprint(store.db.Schema(), "", tableName)
+	callback(blueprint)
+	return store.schemaBuild(ctx, blueprint)
+}
+
+// schemaDrop drops a table
+func (store *storeImplementation) schemaDrop(ctx context.Context, tableName string) error {
+	blueprint := schema.NewBlueprint(store.db.Schema(), "", tableName)
+	blueprint.Drop()
+	return store.schemaBuild(ctx, blueprint)
+}
+
+// schemaBuild compiles the blueprint for the database dialect and executes
+// the statements on the store's executor
+func (store *storeImplementation) schemaBuild(ctx context.Context, blueprint *schema.Blueprint) error {
+	statements, err := blueprint.ToSql(store.grammar())
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if statement == "" {
+			continue
+		}
+		if _, err := store.exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schemaHasTable returns true if the table exists
+func (store *storeImplementation) schemaHasTable(ctx context.Context, tableName string) (bool, error) {
+	sqlStr := `SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ?`
+
+	switch store.dialect() {
+	case contractsdatabase.DriverSqlite, contractsdatabase.DriverTurso:
+		sqlStr = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	case contractsdatabase.DriverMysql:
+		sqlStr += ` AND table_schema = DATABASE()`
+	case contractsdatabase.DriverPostgres:
+		sqlStr += ` AND table_schema = current_schema()`
+	}
+
+	var count int64
+	if err := store.queryRow(ctx, sqlStr, tableName).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// schemaHasColumn returns true if the table has the column
+func (store *storeImplementation) schemaHasColumn(ctx context.Context, tableName string, column string) (bool, error) {
+	rows, err := store.query(ctx, `SELECT * FROM `+tableName+` WHERE 1 = 0`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// == SELECTS =================================================================
+
+// toSelectSQL compiles a neat query into SQL and arguments, so that it can be
+// executed on the store's executor
+func toSelectSQL(q contractsorm.Query) (string, []any, error) {
+	neatQuery, ok := q.(*query.Query)
+	if !ok {
+		return "", nil, errors.New("version store: unsupported query builder")
+	}
+
+	sqlStr, args := query.NewBuilder(neatQuery).BuildSelect()
+	return sqlStr, args, nil
+}
+
+// selectVersions executes a neat query and scans the rows into versions
+func (store *storeImplementation) selectVersions(ctx context.Context, q contractsorm.Query) ([]VersionInterface, error) {
+	sqlStr, args, err := toSelectSQL(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.queryVersions(ctx, sqlStr, args...)
+}
+
+// queryVersions executes a hand written select and scans the rows into
+// versions, filling in the content of those stored as blobs
+func (store *storeImplementation) queryVersions(ctx context.Context, sqlStr string, args ...any) ([]VersionInterface, error) {
+	rows, err := store.query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := scanVersions(rows)
+
+	// the rows are closed before the blobs are read, as the store may be
+	// limited to a single connection
+	if closeErr := rows.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.contentOpenVersions(versions); err != nil {
+		return nil, err
+	}
+
+	if err := store.blobHydrate(ctx, versions); err != nil {
+		return nil, err
+	}
+
+	if err := store.contentDecode(ctx, versions); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// scanVersions scans the rows into versions, mapping each selected column
+// to its version field
+func scanVersions(rows *sql.Rows) ([]VersionInterface, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	list := []VersionInterface{}
+	for rows.Next() {
+		v := &version{}
+
+		dests := make([]any, len(columns))
+		for i, column := range columns {
+			dests[i] = versionColumnDest(v, column)
+		}
+
+		if err := rows.Scan(dests...); err != nil {
+			return nil, err
+		}
+
+		list = append(list, v)
+	}
+
+	return list, rows.Err()
+}
+
+// versionColumnDest returns the scan destination of a column
+func versionColumnDest(v *version, column string) any {
+	switch column {
+	case COLUMN_ID:
+		return &stringScanner{target: &v.ShortID.ID}
+	case COLUMN_ENTITY_TYPE:
+		return &stringScanner{target: &v.EntityTypeField}
+	case COLUMN_ENTITY_ID:
+		return &stringScanner{target: &v.EntityIDField}
+	case COLUMN_PARENT_ID:
+		return &stringScanner{target: &v.ParentIDField}
+	case COLUMN_MERGE_PARENT_ID:
+		return &stringScanner{target: &v.MergeParentIDField}
+	case COLUMN_BRANCH:
+		return &stringScanner{target: &v.BranchField}
+	case COLUMN_AUTHOR_ID:
+		return &stringScanner{target: &v.AuthorIDField}
+	case COLUMN_MESSAGE:
+		return &stringScanner{target: &v.MessageField}
+	case COLUMN_METADATA:
+		return &stringScanner{target: &v.MetadataField}
+	case COLUMN_CHANGESET_ID:
+		return &stringScanner{target: &v.ChangesetIDField}
+	case COLUMN_RESTORED_FROM:
+		return &stringScanner{target: &v.RestoredFromField}
+	case COLUMN_CONTENT:
+		return &stringScanner{target: &v.ContentField}
+	case COLUMN_CONTENT_HASH:
+		return &stringScanner{target: &v.ContentHashField}
+	case COLUMN_CONTENT_KEY_ID:
+		return &stringScanner{target: &v.ContentKeyIDField}
+	case COLUMN_CONTENT_COMPRESSION:
+		return &stringScanner{target: &v.ContentCompressionField}
+	case COLUMN_CONTENT_CODEC:
+		return &stringScanner{target: &v.ContentCodecField}
+	case COLUMN_DELTA_BASE_ID:
+		return &stringScanner{target: &v.DeltaBaseIDField}
+	case COLUMN_DELTA_DEPTH:
+		return &int64Scanner{target: &v.DeltaDepthField}
+	case COLUMN_VERSION_NUMBER:
+		return &int64Scanner{target: &v.VersionNumberField}
+	case COLUMN_CREATED_AT:
+		return &datetimeScanner{target: &v.CreatedAt.CreatedAt}
+	case COLUMN_SOFT_DELETED_AT:
+		return &datetimeScanner{target: &v.SoftDeletedAt}
+	default:
+		return new(any)
+	}
+}
+
+// stringScanner scans a nullable text column into a string
+type stringScanner struct {
+	target *string
+}
+
+func (s *stringScanner) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*s.target = ""
+	case string:
+		*s.target = value
+	case []byte:
+		*s.target = string(value)
+	default:
+		return errors.New("version store: cannot scan text column")
+	}
+	return nil
+}
+
+// int64Scanner scans a nullable integer column into an int64
+type int64Scanner struct {
+	target *int64
+}
+
+func (s *int64Scanner) Scan(src any) error {
+	var n sql.NullInt64
+	if err := n.Scan(src); err != nil {
+		return err
+	}
+	*s.target = n.Int64
+	return nil
+}
+
+// datetimeScanner scans a datetime column into a time.Time, accepting both
+// drivers that return time.Time and drivers that return the stored text
+type datetimeScanner struct {
+	target *time.Time
+}
+
+func (s *datetimeScanner) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*s.target = time.Time{}
+	case time.Time:
+		*s.target = value.UTC()
+	case string:
+		*s.target = carbon.Parse(value, carbon.UTC).StdTime()
+	case []byte:
+		*s.target = carbon.Parse(string(value), carbon.UTC).StdTime()
+	default:
+		return errors.New("version store: cannot scan datetime column")
+	}
+	return nil
+}
+
+// toDateTimeString formats a time the way datetimes are stored
+func toDateTimeString(c *carbon.Carbon) string {
+	return c.ToDateTimeString(carbon.UTC)
+}
@@ -0,0 +1,228 @@
+package versionstore
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// initTxDB returns an in-memory database limited to one connection, so any
+// statement escaping the transaction blocks instead of silently passing
+func initTxDB(t *testing.T) *sql.DB {
+	db := initDB(":memory:")
+	db.SetMaxOpenConns(1)
+
+	_, err := db.Exec(`CREATE TABLE pages (id VARCHAR(40) NOT NULL PRIMARY KEY, title TEXT NOT NULL)`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return db
+}
+
+func countPages(t *testing.T, db *sql.DB) int {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages`).Scan(&count); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return count
+}
+
+func TestStoreWithTx_Rollback(t *testing.T) {
+	db := initTxDB(t)
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_with_tx_rollback",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO pages (id, title) VALUES ('1', 'Home')`); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	version := NewVersion().
+		SetEntityType("page").
+		SetEntityID("1").
+		SetContent("Home")
+
+	if err := store.WithTx(tx).VersionCreate(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	versionFound, err := store.WithTx(tx).VersionFindByID(ctx, version.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if versionFound == nil {
+		t.Fatal("Version MUST be visible inside the transaction")
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if countPages(t, db) != 0 {
+		t.Fatal("Page MUST be removed by the rollback")
+	}
+
+	versionFound, err = store.VersionFindByID(ctx, version.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if versionFound != nil {
+		t.Fatal("Version MUST be removed by the rollback")
+	}
+}
+
+func TestStoreWithTx_Commit(t *testing.T) {
+	db := initTxDB(t)
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_with_tx_commit",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO pages (id, title) VALUES ('1', 'Home')`); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	version := NewVersion().
+		SetEntityType("page").
+		SetEntityID("1").
+		SetContent("Home")
+
+	txStore := store.WithTx(tx)
+
+	if err := txStore.VersionCreate(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := txStore.VersionSoftDelete(ctx, version); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if countPages(t, db) != 1 {
+		t.Fatal("Page MUST be committed")
+	}
+
+	list, err := store.VersionList(ctx, NewVersionQuery().
+		SetID(version.ID()).
+		SetSoftDeletedIncluded(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 1 {
+		t.Fatal("Version MUST be committed")
+	}
+	if !list[0].IsSoftDeleted() {
+		t.Fatal("Version soft delete MUST be committed")
+	}
+}
+
+func TestStoreMigrateUp_WithTx(t *testing.T) {
+	db := initTxDB(t)
+	tableName := "version_migrate_with_tx"
+
+	store, err := NewStore(NewStoreOptions{
+		DB:        db,
+		TableName: tableName,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hasTable := func() bool {
+		var count int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, tableName).Scan(&count)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return count > 0
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MigrateUp(ctx, tx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if hasTable() {
+		t.Fatal("Table MUST be removed by the rollback")
+	}
+
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MigrateUp(ctx, tx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !hasTable() {
+		t.Fatal("Table MUST be committed")
+	}
+
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MigrateDown(ctx, tx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if hasTable() {
+		t.Fatal("Table MUST be dropped")
+	}
+}
@@ -0,0 +1,375 @@
+package versionstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	contractsdatabase "github.com/dracory/neat/contracts/database"
+	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	neatuid "github.com/dracory/neat/support/uid"
+	"github.com/dromara/carbon/v2"
+)
+
+// Column names for the tags table
+const (
+	COLUMN_CREATED_BY = "created_by"
+	COLUMN_REMOVED_AT = "removed_at"
+	COLUMN_REMOVED_BY = "removed_by"
+	COLUMN_TAG_KIND   = "kind"
+	COLUMN_TAG_NAME   = "name"
+)
+
+// TagKind tells tags, which mark a single version of an entity, from labels
+type TagKind string
+
+const (
+	// TAG_KIND_TAG marks a single version of an entity, like a git ref:
+	// tagging another version of the entity moves the tag
+	TAG_KIND_TAG TagKind = "tag"
+
+	// TAG_KIND_LABEL can be put on any number of versions, of any entity
+	TAG_KIND_LABEL TagKind = "label"
+)
+
+// Tag is a tag or label put on a version. Tags are never deleted when moved
+// or removed, so that their history can be listed.
+type Tag struct {
+	ID         string
+	Name       string
+	Kind       TagKind
+	EntityType string
+	EntityID   string
+	VersionID  string
+
+	// CreatedBy and RemovedBy are the actors of the contexts the tag was put
+	// on and removed from the version with
+	CreatedBy string
+	CreatedAt time.Time
+	RemovedBy string
+
+	// RemovedAt is the zero time while the tag is on the version
+	RemovedAt time.Time
+}
+
+// IsActive returns true while the tag is on its version
+func (tag Tag) IsActive() bool {
+	return tag.RemovedAt.IsZero()
+}
+
+// tagTableName returns the name of the tags table
+func (store *storeImplementation) tagTableName() string {
+	return store.tableName + "_tag"
+}
+
+// tagMigrateUp creates the tags table
+func (store *storeImplementation) tagMigrateUp(ctx context.Context) error {
+	hasTable, err := store.schemaHasTable(ctx, store.tagTableName())
+	if err != nil {
+		return err
+	}
+	if hasTable {
+		return nil
+	}
+
+	err = store.schemaCreate(ctx, store.tagTableName(), func(table contractsschema.Blueprint) {
+		table.String(COLUMN_ID, 21)
+		table.Primary(COLUMN_ID)
+		table.String(COLUMN_TAG_NAME, 100)
+		table.String(COLUMN_TAG_KIND, 10)
+		table.String(COLUMN_ENTITY_TYPE, 40)
+		table.String(COLUMN_ENTITY_ID, 40)
+		table.String(COLUMN_VERSION_ID, 21)
+		table.String(COLUMN_CREATED_BY, 100).Default("")
+		table.DateTime(COLUMN_CREATED_AT)
+		table.String(COLUMN_REMOVED_BY, 100).Default("")
+		table.DateTime(COLUMN_REMOVED_AT)
+		table.Index(COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID, COLUMN_TAG_NAME)
+		table.Index(COLUMN_VERSION_ID)
+		table.Index(COLUMN_TAG_NAME)
+	})
+
+	if err != nil {
+		if store.debugEnabled {
+			store.logger.Error("MigrateUp: creating tag table failed", "error", err)
+		}
+		return err
+	}
+
+	return store.tagCreateUniqueIndex(ctx)
+}
+
+// tagCreateUniqueIndex creates the partial unique index guaranteeing that a
+// tag is on a single version of an entity, however many writers move it at
+// once. MySQL and Oracle have no partial indexes; tagPut locks the tag rows
+// of the entity there instead.
+func (store *storeImplementation) tagCreateUniqueIndex(ctx context.Context) error {
+	if store.tagLockRows() {
+		return nil
+	}
+
+	sqlStr := `CREATE UNIQUE INDEX ` + store.tagTableName() + `_active_unique ON ` + store.tagTableName() +
+		` (` + COLUMN_ENTITY_TYPE + `, ` + COLUMN_ENTITY_ID + `, ` + COLUMN_TAG_NAME + `)` +
+		` WHERE ` + COLUMN_REMOVED_AT + ` = '` + MAX_DATETIME + `' AND ` + COLUMN_TAG_KIND + ` = '` + string(TAG_KIND_TAG) + `'`
+
+	if _, err := store.exec(ctx, sqlStr); err != nil {
+		if store.debugEnabled {
+			store.logger.Error("MigrateUp: creating tag index failed", "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// tagLockRows returns true if the database has no partial indexes, so that
+// tagPut must lock the tag rows of the entity
+func (store *storeImplementation) tagLockRows() bool {
+	switch store.dialect() {
+	case contractsdatabase.DriverMysql, contractsdatabase.DriverOracle:
+		return true
+	default:
+		return false
+	}
+}
+
+// tagMigrateDown drops the tags table
+func (store *storeImplementation) tagMigrateDown(ctx context.Context) error {
+	hasTable, err := store.schemaHasTable(ctx, store.tagTableName())
+	if err != nil {
+		return err
+	}
+	if !hasTable {
+		return nil
+	}
+
+	return store.schemaDrop(ctx, store.tagTableName())
+}
+
+// TagVersion puts a tag on a version, moving it from the version of the
+// same entity it was on, if any
+func (store *storeImplementation) TagVersion(ctx context.Context, versionID string, tag string) error {
+	return store.tagPut(ctx, versionID, tag, TAG_KIND_TAG)
+}
+
+// LabelVersion puts a label on a version. A label can be on any number of
+// versions; labelling a version twice does nothing.
+func (store *storeImplementation) LabelVersion(ctx context.Context, versionID string, label string) error {
+	return store.tagPut(ctx, versionID, label, TAG_KIND_LABEL)
+}
+
+// UntagVersion removes a tag or label from a version. Removing a tag or
+// label the version does not have does nothing.
+func (store *storeImplementation) UntagVersion(ctx context.Context, versionID string, tag string) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+	if versionID == "" {
+		return errors.New("version store: version id is required")
+	}
+	if tag == "" {
+		return errors.New("version store: tag is required")
+	}
+
+	_, err := store.exec(ctx, `UPDATE `+store.tagTableName()+
+		` SET `+COLUMN_REMOVED_AT+` = ?, `+COLUMN_REMOVED_BY+` = ?`+
+		` WHERE `+COLUMN_VERSION_ID+` = ? AND `+COLUMN_TAG_NAME+` = ? AND `+COLUMN_REMOVED_AT+` = ?`,
+		toDateTimeString(carbon.Now(carbon.UTC)), ActorFromContext(ctx), versionID, tag, MAX_DATETIME)
+	return err
+}
+
+// VersionFindByTag returns the version of an entity the tag is on, or nil
+// if the tag is on none of its versions
+func (store *storeImplementation) VersionFindByTag(ctx context.Context, entityType string, entityID string, tag string) (VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if entityType == "" {
+		return nil, errors.New("version store: entity type is required")
+	}
+	if entityID == "" {
+		return nil, errors.New("version store: entity id is required")
+	}
+	if tag == "" {
+		return nil, errors.New("version store: tag is required")
+	}
+
+	tags, err := store.queryTags(ctx, ` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`+
+		` AND `+COLUMN_TAG_NAME+` = ? AND `+COLUMN_TAG_KIND+` = ? AND `+COLUMN_REMOVED_AT+` = ?`,
+		entityType, entityID, tag, TAG_KIND_TAG, MAX_DATETIME)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	return store.VersionFindByID(ctx, tags[0].VersionID)
+}
+
+// VersionListByLabel returns the versions with the given label, of any
+// entity, oldest first
+func (store *storeImplementation) VersionListByLabel(ctx context.Context, label string) ([]VersionInterface, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	if label == "" {
+		return nil, errors.New("version store: label is required")
+	}
+
+	now := toDateTimeString(carbon.Now(carbon.UTC))
+
+	return store.queryVersions(ctx, `SELECT * FROM `+store.tableName+
+		` WHERE `+COLUMN_SOFT_DELETED_AT+` > ?`+
+		` AND `+COLUMN_ID+` IN (SELECT `+COLUMN_VERSION_ID+` FROM `+store.tagTableName()+
+		` WHERE `+COLUMN_TAG_NAME+` = ? AND `+COLUMN_TAG_KIND+` = ? AND `+COLUMN_REMOVED_AT+` = ?)`+
+		` ORDER BY `+COLUMN_CREATED_AT+`, `+COLUMN_VERSION_NUMBER,
+		now, label, TAG_KIND_LABEL, MAX_DATETIME)
+}
+
+// VersionTags returns the tags and labels on a version
+func (store *storeImplementation) VersionTags(ctx context.Context, versionID string) ([]Tag, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+
+	return store.queryTags(ctx, ` WHERE `+COLUMN_VERSION_ID+` = ? AND `+COLUMN_REMOVED_AT+` = ?`, versionID, MAX_DATETIME)
+}
+
+// TagHistory returns every version of an entity the tag or label was put
+// on, removed ones included, oldest first
+func (store *storeImplementation) TagHistory(ctx context.Context, entityType string, entityID string, tag string) ([]Tag, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+
+	return store.queryTags(ctx, ` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ? AND `+COLUMN_TAG_NAME+` = ?`,
+		entityType, entityID, tag)
+}
+
+// tagPut puts a tag or label on a version
+func (store *storeImplementation) tagPut(ctx context.Context, versionID string, name string, kind TagKind) error {
+	if ctx == nil {
+		return errors.New("ctx is nil")
+	}
+	if versionID == "" {
+		return errors.New("version store: version id is required")
+	}
+	if name == "" {
+		return errors.New("version store: tag is required")
+	}
+
+	return store.transaction(ctx, func(txStore *storeImplementation) error {
+		version, err := txStore.VersionFindByID(ctx, versionID)
+		if err != nil {
+			return err
+		}
+		if version == nil {
+			return errors.New("version store: version not found")
+		}
+
+		if txStore.tagLockRows() {
+			if err := txStore.tagLock(ctx, version.EntityType(), version.EntityID(), name); err != nil {
+				return err
+			}
+		}
+
+		active, err := txStore.queryTags(ctx, ` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ?`+
+			` AND `+COLUMN_TAG_NAME+` = ? AND `+COLUMN_REMOVED_AT+` = ?`,
+			version.EntityType(), version.EntityID(), name, MAX_DATETIME)
+		if err != nil {
+			return err
+		}
+
+		now := toDateTimeString(carbon.Now(carbon.UTC))
+		actor := ActorFromContext(ctx)
+
+		// a tag moves from the version it is on, a label stays on every
+		// version it is on
+		for _, tag := range active {
+			if tag.Kind != kind {
+				return errors.New("version store: " + name + " is already used as a " + string(tag.Kind) + " of the entity")
+			}
+			if tag.VersionID == versionID {
+				return nil
+			}
+			if kind == TAG_KIND_LABEL {
+				continue
+			}
+
+			_, err := txStore.exec(ctx, `UPDATE `+txStore.tagTableName()+
+				` SET `+COLUMN_REMOVED_AT+` = ?, `+COLUMN_REMOVED_BY+` = ?`+
+				` WHERE `+COLUMN_ID+` = ?`, now, actor, tag.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = txStore.exec(ctx, `INSERT INTO `+txStore.tagTableName()+
+			` (`+strings.Join([]string{COLUMN_ID, COLUMN_TAG_NAME, COLUMN_TAG_KIND, COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID, COLUMN_VERSION_ID, COLUMN_CREATED_BY, COLUMN_CREATED_AT, COLUMN_REMOVED_BY, COLUMN_REMOVED_AT}, ", ")+`)`+
+			` VALUES (?, ?, ?, ?, ?, ?, ?, ?, '', ?)`,
+			neatuid.GenerateShortID(), name, kind, version.EntityType(), version.EntityID(), versionID, actor, now, MAX_DATETIME)
+		return err
+	})
+}
+
+// tagLock locks the rows of a tag of an entity, and the gap they would be
+// inserted in, until the end of the transaction
+func (store *storeImplementation) tagLock(ctx context.Context, entityType string, entityID string, name string) error {
+	rows, err := store.query(ctx, `SELECT `+COLUMN_ID+` FROM `+store.tagTableName()+
+		` WHERE `+COLUMN_ENTITY_TYPE+` = ? AND `+COLUMN_ENTITY_ID+` = ? AND `+COLUMN_TAG_NAME+` = ?`+
+		` FOR UPDATE`, entityType, entityID, name)
+	if err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// tagRemoveFromVersions removes the tags and labels on the versions with
+// the given ids, as they are hard deleted
+func (store *storeImplementation) tagRemoveFromVersions(ctx context.Context, ids []string) error {
+	args := []any{toDateTimeString(carbon.Now(carbon.UTC)), ActorFromContext(ctx)}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, MAX_DATETIME)
+
+	_, err := store.exec(ctx, `UPDATE `+store.tagTableName()+
+		` SET `+COLUMN_REMOVED_AT+` = ?, `+COLUMN_REMOVED_BY+` = ?`+
+		` WHERE `+COLUMN_VERSION_ID+` IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+`)`+
+		` AND `+COLUMN_REMOVED_AT+` = ?`, args...)
+	return err
+}
+
+// queryTags returns the tags matching the given where clause, oldest first
+func (store *storeImplementation) queryTags(ctx context.Context, where string, args ...any) ([]Tag, error) {
+	rows, err := store.query(ctx, `SELECT `+strings.Join([]string{COLUMN_ID, COLUMN_TAG_NAME, COLUMN_TAG_KIND, COLUMN_ENTITY_TYPE, COLUMN_ENTITY_ID, COLUMN_VERSION_ID, COLUMN_CREATED_BY, COLUMN_CREATED_AT, COLUMN_REMOVED_BY, COLUMN_REMOVED_AT}, ", ")+
+		` FROM `+store.tagTableName()+where+
+		` ORDER BY `+COLUMN_CREATED_AT+`, `+COLUMN_REMOVED_AT, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		var kind string
+		if err := rows.Scan(&tag.ID, &tag.Name, &kind, &tag.EntityType, &tag.EntityID, &tag.VersionID,
+			&tag.CreatedBy, &datetimeScanner{target: &tag.CreatedAt},
+			&tag.RemovedBy, &datetimeScanner{target: &tag.RemovedAt}); err != nil {
+			return nil, err
+		}
+
+		tag.Kind = TagKind(kind)
+		if toDateTimeString(carbon.CreateFromStdTime(tag.RemovedAt)) == MAX_DATETIME {
+			tag.RemovedAt = time.Time{}
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,137 @@
+package versionstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStoreTagVersion(t *testing.T) {
+	db := initDB(":memory:")
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		TableName:          "version_tag",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	v1 := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("first")
+	v2 := NewVersion().SetEntityType("page").SetEntityID("1").SetContent("second")
+	other := NewVersion().SetEntityType("page").SetEntityID("2").SetContent("other")
+	for _, version := range []VersionInterface{v1, v2, other} {
+		if err := store.VersionCreate(ctx, version); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if err := store.TagVersion(WithActor(ctx, "alice"), v1.ID(), "published"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.TagVersion(WithActor(ctx, "bob"), v2.ID(), "published"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := store.TagVersion(ctx, other.ID(), "published"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.VersionFindByTag(ctx, "page", "1", "published")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.ID() != v2.ID() {
+		t.Fatal("Tag MUST move to the last version tagged. Found:", found)
+	}
+
+	history, err := store.TagHistory(ctx, "page", "1", "published")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(history) != 2 || history[0].VersionID != v1.ID() || history[1].VersionID != v2.ID() {
+		t.Fatal("Tag history MUST list every version tagged. Found:", history)
+	}
+	if history[0].IsActive() || history[0].CreatedBy != "alice" || history[0].RemovedBy != "bob" {
+		t.Fatal("Moved tag MUST record when and by whom it was moved. Found:", history[0])
+	}
+	if !history[1].IsActive() || history[1].Kind != TAG_KIND_TAG {
+		t.Fatal("Current tag MUST be active. Found:", history[1])
+	}
+
+	_, err = db.Exec(`INSERT INTO version_tag_tag (id, name, kind, entity_type, entity_id, version_id, created_by, created_at, removed_by, removed_at)`+
+		` VALUES ('racing', 'published', 'tag', 'page', '1', ?, '', ?, '', ?)`, v1.ID(), MAX_DATETIME, MAX_DATETIME)
+	if err == nil {
+		t.Fatal("A second active tag of the same name on an entity MUST be rejected")
+	}
+
+	for _, version := range []VersionInterface{v1, v2, v2} {
+		if err := store.LabelVersion(ctx, version.ID(), "reviewed"); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	labelled, err := store.VersionListByLabel(ctx, "reviewed")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(labelled) != 2 {
+		t.Fatal("Label MUST stay on every version labelled. Found:", len(labelled))
+	}
+
+	if err := store.TagVersion(ctx, v1.ID(), "reviewed"); err == nil {
+		t.Fatal("Tagging with a label name MUST fail")
+	}
+	if err := store.LabelVersion(ctx, v1.ID(), "published"); err == nil {
+		t.Fatal("Labelling with a tag name MUST fail")
+	}
+	if err := store.TagVersion(ctx, "missing", "published"); err == nil {
+		t.Fatal("Tagging a missing version MUST fail")
+	}
+
+	if err := store.UntagVersion(ctx, v1.ID(), "reviewed"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	tags, err := store.VersionTags(ctx, v1.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(tags) != 0 {
+		t.Fatal("Removed label MUST not be listed. Found:", tags)
+	}
+
+	if err := store.VersionDelete(ctx, v2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.VersionFindByTag(ctx, "page", "1", "published")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found != nil {
+		t.Fatal("Tag of a deleted version MUST be removed. Found:", found)
+	}
+
+	if _, err := store.EraseEntity(ctx, "page", "1"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	history, err = store.TagHistory(ctx, "page", "1", "published")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(history) != 0 {
+		t.Fatal("Erased entity MUST have no tag history. Found:", history)
+	}
+
+	found, err = store.VersionFindByTag(ctx, "page", "2", "published")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if found == nil || found.ID() != other.ID() {
+		t.Fatal("Tags MUST be per entity. Found:", found)
+	}
+}
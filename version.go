@@ -1,6 +1,8 @@
 package versionstore
 
 import (
+	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/dracory/neat/database/orm"
@@ -26,7 +28,21 @@ func NewVersionFromExistingData(data map[string]string) VersionInterface {
 	o.SetID(data[COLUMN_ID])
 	o.SetEntityType(data[COLUMN_ENTITY_TYPE])
 	o.SetEntityID(data[COLUMN_ENTITY_ID])
+	o.SetParentID(data[COLUMN_PARENT_ID])
+	o.SetMergeParentID(data[COLUMN_MERGE_PARENT_ID])
+	o.SetBranch(data[COLUMN_BRANCH])
+	o.SetRestoredFrom(data[COLUMN_RESTORED_FROM])
 	o.SetContent(data[COLUMN_CONTENT])
+	o.SetContentHash(data[COLUMN_CONTENT_HASH])
+	o.SetAuthorID(data[COLUMN_AUTHOR_ID])
+	o.SetMessage(data[COLUMN_MESSAGE])
+	o.MetadataField = data[COLUMN_METADATA]
+	o.SetChangesetID(data[COLUMN_CHANGESET_ID])
+	if v, ok := data[COLUMN_VERSION_NUMBER]; ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			o.SetVersionNumber(n)
+		}
+	}
 	if v, ok := data[COLUMN_CREATED_AT]; ok {
 		o.SetCreatedAt(v)
 	}
@@ -43,9 +59,35 @@ var _ VersionInterface = (*version)(nil)
 type version struct {
 	orm.ShortID
 
-	EntityTypeField string `db:"entity_type"`
-	EntityIDField   string `db:"entity_id"`
-	ContentField    string `db:"content"`
+	EntityTypeField  string `db:"entity_type"`
+	EntityIDField    string `db:"entity_id"`
+	ContentField     string `db:"content"`
+	ContentHashField string `db:"content_hash"`
+
+	VersionNumberField int64  `db:"version_number"`
+	ParentIDField      string `db:"parent_id"`
+	MergeParentIDField string `db:"merge_parent_id"`
+	BranchField        string `db:"branch"`
+	RestoredFromField  string `db:"restored_from"`
+
+	AuthorIDField string `db:"author_id"`
+	MessageField  string `db:"message"`
+
+	// MetadataField holds the metadata as a JSON object of strings
+	MetadataField string `db:"metadata"`
+
+	// ChangesetIDField is the id of the changeset the version was committed
+	// with, empty for versions created on their own
+	ChangesetIDField string `db:"changeset_id"`
+
+	// ContentCodecField, DeltaBaseIDField, DeltaDepthField,
+	// ContentCompressionField and ContentKeyIDField describe how the content
+	// is stored. They are managed by the store.
+	ContentCodecField       string `db:"content_codec"`
+	DeltaBaseIDField        string `db:"delta_base_id"`
+	DeltaDepthField         int64  `db:"delta_depth"`
+	ContentCompressionField string `db:"content_compression"`
+	ContentKeyIDField       string `db:"content_key_id"`
 
 	orm.CreatedAt
 	soft_delete.SoftDeletesMaxDate
@@ -53,9 +95,12 @@ type version struct {
 
 // == METHODS =================================================================
 
-// IsSoftDeleted returns true if the version is soft deleted.
+// IsSoftDeleted returns true if the version is soft deleted. Like the store
+// queries it compares at second precision, the precision datetimes are
+// stored with, so a version expiring at a given second is soft deleted from
+// that second on.
 func (o *version) IsSoftDeleted() bool {
-	return o.SoftDeletedAt.Before(time.Now().UTC())
+	return !o.SoftDeletedAt.After(time.Now().UTC().Truncate(time.Second))
 }
 
 // == SETTERS AND GETTERS =====================================================
@@ -104,6 +149,146 @@ func (o *version) SetContent(content string) VersionInterface {
 	return o
 }
 
+// ContentHash returns the hex encoded SHA-256 hash of the content, or its
+// HMAC-SHA256 for the encrypted entity types, as computed by the store when
+// the version was created.
+func (o *version) ContentHash() string {
+	return o.ContentHashField
+}
+
+// SetContentHash sets the content hash of the version.
+func (o *version) SetContentHash(contentHash string) VersionInterface {
+	o.ContentHashField = contentHash
+	return o
+}
+
+// VersionNumber returns the per-entity sequence number of the version.
+// It is assigned by the store on create and is 0 for unsaved versions.
+func (o *version) VersionNumber() int64 {
+	return o.VersionNumberField
+}
+
+// SetVersionNumber sets the per-entity sequence number of the version.
+func (o *version) SetVersionNumber(versionNumber int64) VersionInterface {
+	o.VersionNumberField = versionNumber
+	return o
+}
+
+// ParentID returns the id of the version this version was derived from.
+// It is empty for the first version of an entity.
+func (o *version) ParentID() string {
+	return o.ParentIDField
+}
+
+// SetParentID sets the id of the version this version was derived from.
+func (o *version) SetParentID(parentID string) VersionInterface {
+	o.ParentIDField = parentID
+	return o
+}
+
+// MergeParentID returns the id of the second parent of a merge version,
+// the version that was merged into ParentID. It is empty for other versions.
+func (o *version) MergeParentID() string {
+	return o.MergeParentIDField
+}
+
+// SetMergeParentID sets the id of the second parent of a merge version.
+func (o *version) SetMergeParentID(mergeParentID string) VersionInterface {
+	o.MergeParentIDField = mergeParentID
+	return o
+}
+
+// Branch returns the branch name of the version.
+func (o *version) Branch() string {
+	return o.BranchField
+}
+
+// SetBranch sets the branch name of the version.
+func (o *version) SetBranch(branch string) VersionInterface {
+	o.BranchField = branch
+	return o
+}
+
+// RestoredFrom returns the id of the version whose content this version
+// restored. It is empty for versions not created by a restore.
+func (o *version) RestoredFrom() string {
+	return o.RestoredFromField
+}
+
+// SetRestoredFrom sets the id of the version whose content this version restored.
+func (o *version) SetRestoredFrom(restoredFrom string) VersionInterface {
+	o.RestoredFromField = restoredFrom
+	return o
+}
+
+// AuthorID returns the id of the user who saved the version.
+func (o *version) AuthorID() string {
+	return o.AuthorIDField
+}
+
+// SetAuthorID sets the id of the user who saved the version.
+func (o *version) SetAuthorID(authorID string) VersionInterface {
+	o.AuthorIDField = authorID
+	return o
+}
+
+// Message returns the message describing the change the version made.
+func (o *version) Message() string {
+	return o.MessageField
+}
+
+// SetMessage sets the message describing the change the version made.
+func (o *version) SetMessage(message string) VersionInterface {
+	o.MessageField = message
+	return o
+}
+
+// Meta returns the metadata value with the given key, empty if not set.
+func (o *version) Meta(key string) string {
+	return o.Metas()[key]
+}
+
+// SetMeta sets the metadata value with the given key.
+func (o *version) SetMeta(key string, value string) VersionInterface {
+	metas := o.Metas()
+	metas[key] = value
+	return o.SetMetas(metas)
+}
+
+// Metas returns a copy of all the metadata of the version.
+func (o *version) Metas() map[string]string {
+	metas := map[string]string{}
+	if o.MetadataField != "" {
+		_ = json.Unmarshal([]byte(o.MetadataField), &metas)
+	}
+	return metas
+}
+
+// SetMetas replaces all the metadata of the version.
+func (o *version) SetMetas(metas map[string]string) VersionInterface {
+	if len(metas) == 0 {
+		o.MetadataField = ""
+		return o
+	}
+
+	// a map of strings always marshals, with its keys sorted
+	data, _ := json.Marshal(metas)
+	o.MetadataField = string(data)
+	return o
+}
+
+// ChangesetID returns the id of the changeset the version was committed
+// with. It is empty for versions created on their own.
+func (o *version) ChangesetID() string {
+	return o.ChangesetIDField
+}
+
+// SetChangesetID sets the id of the changeset the version was committed with.
+func (o *version) SetChangesetID(changesetID string) VersionInterface {
+	o.ChangesetIDField = changesetID
+	return o
+}
+
 // GetCreatedAt returns the created at time of the version.
 func (o *version) GetCreatedAt() string {
 	if o.CreatedAt.CreatedAt.IsZero() {
@@ -139,6 +324,24 @@ func (o *version) GetSoftDeletedAtCarbon() *carbon.Carbon {
 	return carbon.CreateFromStdTime(o.SoftDeletedAt)
 }
 
+// ExpiresAt returns the time the version is soft deleted at, or the zero
+// time if it never expires.
+func (o *version) ExpiresAt() time.Time {
+	if o.GetSoftDeletedAt() == "" || o.GetSoftDeletedAt() == MAX_DATETIME {
+		return time.Time{}
+	}
+	return o.SoftDeletedAt
+}
+
+// SetExpiresAt schedules the version to be soft deleted at the given time,
+// truncated to the second. The zero time makes the version never expire.
+func (o *version) SetExpiresAt(expiresAt time.Time) VersionInterface {
+	if expiresAt.IsZero() {
+		return o.SetSoftDeletedAt(MAX_DATETIME)
+	}
+	return o.SetSoftDeletedAt(toDateTimeString(carbon.CreateFromStdTime(expiresAt)))
+}
+
 // SetSoftDeletedAt sets the soft deleted at time of the version.
 func (o *version) SetSoftDeletedAt(softDeletedAt string) VersionInterface {
 	if softDeletedAt == "" {
@@ -1,6 +1,9 @@
 package versionstore
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // NewVersionQuery creates a new version query
 func NewVersionQuery() VersionQueryInterface {
@@ -24,10 +27,18 @@ func (q *versionQuery) Validate() error {
 		return errors.New("version query. entity_type cannot be empty")
 	}
 
+	if q.HasBranch() && q.Branch() == "" {
+		return errors.New("version query. branch cannot be empty")
+	}
+
 	if q.HasID() && q.ID() == "" {
 		return errors.New("version query. id cannot be empty")
 	}
 
+	if q.HasVersionNumber() && q.VersionNumber() < 1 {
+		return errors.New("version query. version_number cannot be less than 1")
+	}
+
 	if q.HasLimit() && q.Limit() < 0 {
 		return errors.New("version query. limit cannot be negative")
 	}
@@ -40,6 +51,18 @@ func (q *versionQuery) Validate() error {
 		return errors.New("version query. offset cannot be negative")
 	}
 
+	if q.SoftDeletedIncluded() && q.SoftDeletedOnly() {
+		return errors.New("version query. soft_deleted_included and soft_deleted_only cannot both be set")
+	}
+
+	if q.HasAuthorID() && q.AuthorID() == "" {
+		return errors.New("version query. author_id cannot be empty")
+	}
+
+	if q.HasAsOf() && q.AsOf().IsZero() {
+		return errors.New("version query. as_of cannot be zero")
+	}
+
 	return nil
 }
 
@@ -138,6 +161,126 @@ func (q *versionQuery) SetID(id string) VersionQueryInterface {
 	return q
 }
 
+// HasParentID returns true if parent_id is set
+func (q *versionQuery) HasParentID() bool {
+	return q.hasProperty("parent_id")
+}
+
+// ParentID returns the parent version ID
+func (q *versionQuery) ParentID() string {
+	if !q.hasProperty("parent_id") {
+		return ""
+	}
+
+	return q.properties["parent_id"].(string)
+}
+
+// SetParentID sets the parent version ID
+func (q *versionQuery) SetParentID(parentID string) VersionQueryInterface {
+	q.properties["parent_id"] = parentID
+	return q
+}
+
+// HasContentHash returns true if content hash is set
+func (q *versionQuery) HasContentHash() bool {
+	return q.hasProperty("content_hash")
+}
+
+// ContentHash returns the content hash
+func (q *versionQuery) ContentHash() string {
+	if !q.hasProperty("content_hash") {
+		return ""
+	}
+
+	return q.properties["content_hash"].(string)
+}
+
+// SetContentHash sets the content hash
+func (q *versionQuery) SetContentHash(contentHash string) VersionQueryInterface {
+	q.properties["content_hash"] = contentHash
+	return q
+}
+
+// HasBranch returns true if branch is set
+func (q *versionQuery) HasBranch() bool {
+	return q.hasProperty("branch")
+}
+
+// Branch returns the branch name
+func (q *versionQuery) Branch() string {
+	if !q.hasProperty("branch") {
+		return ""
+	}
+
+	return q.properties["branch"].(string)
+}
+
+// SetBranch sets the branch name
+func (q *versionQuery) SetBranch(branch string) VersionQueryInterface {
+	q.properties["branch"] = branch
+	return q
+}
+
+// HasVersionNumber returns true if version_number is set
+func (q *versionQuery) HasVersionNumber() bool {
+	return q.hasProperty("version_number")
+}
+
+// VersionNumber returns the version number
+func (q *versionQuery) VersionNumber() int64 {
+	if !q.hasProperty("version_number") {
+		return 0
+	}
+
+	return q.properties["version_number"].(int64)
+}
+
+// SetVersionNumber sets the version number
+func (q *versionQuery) SetVersionNumber(versionNumber int64) VersionQueryInterface {
+	q.properties["version_number"] = versionNumber
+	return q
+}
+
+// HasVersionNumberGreaterThan returns true if version_number_gt is set
+func (q *versionQuery) HasVersionNumberGreaterThan() bool {
+	return q.hasProperty("version_number_gt")
+}
+
+// VersionNumberGreaterThan returns the exclusive lower bound of the version number
+func (q *versionQuery) VersionNumberGreaterThan() int64 {
+	if !q.hasProperty("version_number_gt") {
+		return 0
+	}
+
+	return q.properties["version_number_gt"].(int64)
+}
+
+// SetVersionNumberGreaterThan sets the exclusive lower bound of the version number
+func (q *versionQuery) SetVersionNumberGreaterThan(versionNumber int64) VersionQueryInterface {
+	q.properties["version_number_gt"] = versionNumber
+	return q
+}
+
+// HasVersionNumberLessThan returns true if version_number_lt is set
+func (q *versionQuery) HasVersionNumberLessThan() bool {
+	return q.hasProperty("version_number_lt")
+}
+
+// VersionNumberLessThan returns the exclusive upper bound of the version number
+func (q *versionQuery) VersionNumberLessThan() int64 {
+	if !q.hasProperty("version_number_lt") {
+		return 0
+	}
+
+	return q.properties["version_number_lt"].(int64)
+}
+
+// SetVersionNumberLessThan sets the exclusive upper bound of the version number
+func (q *versionQuery) SetVersionNumberLessThan(versionNumber int64) VersionQueryInterface {
+	q.properties["version_number_lt"] = versionNumber
+	return q
+}
+
 // HasLimit returns true if limit is set
 func (q *versionQuery) HasLimit() bool {
 	return q.hasProperty("limit")
@@ -238,6 +381,110 @@ func (q *versionQuery) SetSoftDeletedIncluded(softDeletedIncluded bool) VersionQ
 	return q
 }
 
+// HasSoftDeletedOnly returns true if soft_deleted_only is set
+func (q *versionQuery) HasSoftDeletedOnly() bool {
+	return q.hasProperty("soft_deleted_only")
+}
+
+// SoftDeletedOnly returns true if only soft deleted versions should be returned
+func (q *versionQuery) SoftDeletedOnly() bool {
+	if q.hasProperty("soft_deleted_only") {
+		return q.properties["soft_deleted_only"].(bool)
+	}
+
+	return false
+}
+
+// SetSoftDeletedOnly sets whether to return only soft deleted versions
+func (q *versionQuery) SetSoftDeletedOnly(softDeletedOnly bool) VersionQueryInterface {
+	q.properties["soft_deleted_only"] = softDeletedOnly
+	return q
+}
+
+// HasAsOf returns true if as_of is set
+func (q *versionQuery) HasAsOf() bool {
+	return q.hasProperty("as_of")
+}
+
+// AsOf returns the moment the versions are looked at, as they were then
+func (q *versionQuery) AsOf() time.Time {
+	if !q.hasProperty("as_of") {
+		return time.Time{}
+	}
+
+	return q.properties["as_of"].(time.Time)
+}
+
+// SetAsOf sets the moment the versions are looked at: only the versions
+// created at or before it, and not yet soft deleted then, are returned
+func (q *versionQuery) SetAsOf(asOf time.Time) VersionQueryInterface {
+	q.properties["as_of"] = asOf
+	return q
+}
+
+// HasAuthorID returns true if author_id is set
+func (q *versionQuery) HasAuthorID() bool {
+	return q.hasProperty("author_id")
+}
+
+// AuthorID returns the author id to filter by
+func (q *versionQuery) AuthorID() string {
+	if !q.hasProperty("author_id") {
+		return ""
+	}
+
+	return q.properties["author_id"].(string)
+}
+
+// SetAuthorID sets the author id to filter by
+func (q *versionQuery) SetAuthorID(authorID string) VersionQueryInterface {
+	q.properties["author_id"] = authorID
+	return q
+}
+
+// HasMessageContains returns true if message_contains is set
+func (q *versionQuery) HasMessageContains() bool {
+	return q.hasProperty("message_contains")
+}
+
+// MessageContains returns the text the message must contain
+func (q *versionQuery) MessageContains() string {
+	if !q.hasProperty("message_contains") {
+		return ""
+	}
+
+	return q.properties["message_contains"].(string)
+}
+
+// SetMessageContains sets the text the message must contain
+func (q *versionQuery) SetMessageContains(text string) VersionQueryInterface {
+	q.properties["message_contains"] = text
+	return q
+}
+
+// HasMetas returns true if metadata values to filter by are set
+func (q *versionQuery) HasMetas() bool {
+	return q.hasProperty("metas")
+}
+
+// Metas returns the metadata values to filter by
+func (q *versionQuery) Metas() map[string]string {
+	if !q.hasProperty("metas") {
+		return map[string]string{}
+	}
+
+	return q.properties["metas"].(map[string]string)
+}
+
+// SetMeta adds a metadata value the versions must have. It can be called
+// several times to filter by several keys.
+func (q *versionQuery) SetMeta(key string, value string) VersionQueryInterface {
+	metas := q.Metas()
+	metas[key] = value
+	q.properties["metas"] = metas
+	return q
+}
+
 // hasProperty returns true if the property exists in the map
 func (q *versionQuery) hasProperty(key string) bool {
 	return q.properties[key] != nil
@@ -1,6 +1,9 @@
 package versionstore
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestNewVersion(t *testing.T) {
 	version := NewVersion()
@@ -28,6 +31,7 @@ func TestNewVersionFromExistingData(t *testing.T) {
 		COLUMN_ENTITY_TYPE:     "test-entity-type",
 		COLUMN_ENTITY_ID:       "test-entity-id",
 		COLUMN_CONTENT:         "test-content",
+		COLUMN_VERSION_NUMBER:  "3",
 		COLUMN_CREATED_AT:      "2024-01-01 00:00:00",
 		COLUMN_SOFT_DELETED_AT: MAX_DATETIME,
 	}
@@ -54,6 +58,10 @@ func TestNewVersionFromExistingData(t *testing.T) {
 		t.Errorf("Content() = %s, want %s", version.Content(), "test-content")
 	}
 
+	if version.VersionNumber() != 3 {
+		t.Errorf("VersionNumber() = %d, want %d", version.VersionNumber(), 3)
+	}
+
 	if version.GetCreatedAt() != "2024-01-01 00:00:00" {
 		t.Errorf("CreatedAt() = %s, want %s", version.GetCreatedAt(), "2024-01-01 00:00:00")
 	}
@@ -206,3 +214,197 @@ func TestVersionMethodChaining(t *testing.T) {
 		t.Errorf("Method chaining failed for SoftDeletedAt, got %s", version.GetSoftDeletedAt())
 	}
 }
+
+func TestVersionVersionNumber(t *testing.T) {
+	version := NewVersion()
+
+	if version.VersionNumber() != 0 {
+		t.Errorf("VersionNumber() should be 0 initially, got %d", version.VersionNumber())
+	}
+
+	result := version.SetVersionNumber(7)
+
+	if result != version {
+		t.Error("SetVersionNumber() should return the same instance for chaining")
+	}
+
+	if version.VersionNumber() != 7 {
+		t.Errorf("VersionNumber() = %d, want %d", version.VersionNumber(), 7)
+	}
+}
+
+func TestVersionParentID(t *testing.T) {
+	version := NewVersion()
+
+	if version.ParentID() != "" {
+		t.Errorf("ParentID() should be empty initially, got %s", version.ParentID())
+	}
+
+	result := version.SetParentID("parent-id")
+
+	if result != version {
+		t.Error("SetParentID() should return the same instance for chaining")
+	}
+
+	if version.ParentID() != "parent-id" {
+		t.Errorf("ParentID() = %s, want %s", version.ParentID(), "parent-id")
+	}
+}
+
+func TestVersionBranch(t *testing.T) {
+	version := NewVersion()
+
+	if version.Branch() != "" {
+		t.Errorf("Branch() should be empty initially, got %s", version.Branch())
+	}
+
+	result := version.SetBranch("draft")
+
+	if result != version {
+		t.Error("SetBranch() should return the same instance for chaining")
+	}
+
+	if version.Branch() != "draft" {
+		t.Errorf("Branch() = %s, want %s", version.Branch(), "draft")
+	}
+}
+
+func TestVersionMergeParentID(t *testing.T) {
+	version := NewVersion()
+
+	if version.MergeParentID() != "" {
+		t.Errorf("MergeParentID() should be empty initially, got %s", version.MergeParentID())
+	}
+
+	result := version.SetMergeParentID("merge-parent-id")
+
+	if result != version {
+		t.Error("SetMergeParentID() should return the same instance for chaining")
+	}
+
+	if version.MergeParentID() != "merge-parent-id" {
+		t.Errorf("MergeParentID() = %s, want %s", version.MergeParentID(), "merge-parent-id")
+	}
+}
+
+func TestVersionRestoredFrom(t *testing.T) {
+	version := NewVersion()
+
+	if version.RestoredFrom() != "" {
+		t.Errorf("RestoredFrom() should be empty initially, got %s", version.RestoredFrom())
+	}
+
+	result := version.SetRestoredFrom("restored-from")
+
+	if result != version {
+		t.Error("SetRestoredFrom() should return the same instance for chaining")
+	}
+
+	if version.RestoredFrom() != "restored-from" {
+		t.Errorf("RestoredFrom() = %s, want %s", version.RestoredFrom(), "restored-from")
+	}
+}
+
+func TestVersionExpiresAt(t *testing.T) {
+	version := NewVersion()
+
+	if !version.ExpiresAt().IsZero() {
+		t.Errorf("ExpiresAt() should be zero initially, got %s", version.ExpiresAt())
+	}
+
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 600, time.UTC)
+	result := version.SetExpiresAt(expiresAt)
+
+	if result != version {
+		t.Error("SetExpiresAt() should return the same instance for chaining")
+	}
+
+	if !version.ExpiresAt().Equal(expiresAt.Truncate(time.Second)) {
+		t.Errorf("ExpiresAt() = %s, want %s", version.ExpiresAt(), expiresAt.Truncate(time.Second))
+	}
+
+	if version.GetSoftDeletedAt() != "2030-01-02 03:04:05" {
+		t.Errorf("GetSoftDeletedAt() = %s, want %s", version.GetSoftDeletedAt(), "2030-01-02 03:04:05")
+	}
+
+	version.SetExpiresAt(time.Time{})
+
+	if version.GetSoftDeletedAt() != MAX_DATETIME {
+		t.Errorf("SetExpiresAt() with the zero time should reset SoftDeletedAt to %s, got %s", MAX_DATETIME, version.GetSoftDeletedAt())
+	}
+}
+
+func TestVersionContentHash(t *testing.T) {
+	version := NewVersion()
+
+	if version.ContentHash() != "" {
+		t.Errorf("ContentHash() should be empty initially, got %s", version.ContentHash())
+	}
+
+	result := version.SetContentHash("content-hash")
+
+	if result != version {
+		t.Error("SetContentHash() should return the same instance for chaining")
+	}
+
+	if version.ContentHash() != "content-hash" {
+		t.Errorf("ContentHash() = %s, want %s", version.ContentHash(), "content-hash")
+	}
+}
+
+func TestVersionAuthorIDAndMessage(t *testing.T) {
+	version := NewVersion()
+
+	if version.AuthorID() != "" || version.Message() != "" {
+		t.Error("AuthorID() and Message() should be empty initially")
+	}
+
+	result := version.SetAuthorID("user-1").SetMessage("fix typo")
+
+	if result != version {
+		t.Error("SetAuthorID() and SetMessage() should return the same instance for chaining")
+	}
+
+	if version.AuthorID() != "user-1" {
+		t.Errorf("AuthorID() = %s, want %s", version.AuthorID(), "user-1")
+	}
+
+	if version.Message() != "fix typo" {
+		t.Errorf("Message() = %s, want %s", version.Message(), "fix typo")
+	}
+}
+
+func TestVersionMeta(t *testing.T) {
+	version := NewVersion()
+
+	if len(version.Metas()) != 0 {
+		t.Errorf("Metas() should be empty initially, got %v", version.Metas())
+	}
+
+	result := version.SetMeta("source", "api").SetMeta("ticket", "42")
+
+	if result != version {
+		t.Error("SetMeta() should return the same instance for chaining")
+	}
+
+	if version.Meta("source") != "api" || version.Meta("ticket") != "42" {
+		t.Errorf("Meta() = %v, want source=api and ticket=42", version.Metas())
+	}
+
+	if version.Meta("missing") != "" {
+		t.Errorf("Meta() of a missing key should be empty, got %s", version.Meta("missing"))
+	}
+
+	metas := version.Metas()
+	metas["source"] = "changed"
+
+	if version.Meta("source") != "api" {
+		t.Error("Metas() should return a copy")
+	}
+
+	version.SetMetas(nil)
+
+	if len(version.Metas()) != 0 {
+		t.Errorf("SetMetas(nil) should clear the metadata, got %v", version.Metas())
+	}
+}